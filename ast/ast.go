@@ -2,13 +2,16 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"mlang/token"
+	"strconv"
 	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.TokenPosition
 }
 
 type Statement interface {
@@ -31,6 +34,12 @@ func (p *Program) TokenLiteral() string {
 	}
 	return ""
 }
+func (p *Program) Pos() token.TokenPosition {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.TokenPosition{}
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -41,31 +50,59 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// Scope вид переменной, к которой относится идентификатор
+type Scope int
+
+const (
+	UNRESOLVED Scope = iota
+	LOCAL            // переменная функции или окружающей ее функции
+	GLOBAL           // переменная верхнего уровня программы
+	BUILTIN          // встроенная функция
+)
+
 type Identifier struct {
 	Token token.Token
 	Value string
+
+	// Заполняются при разрешении имен (пакет resolver).
+	// Depth - на сколько функций выше места использования объявлена переменная,
+	// Slot - номер переменной в окружении, где она объявлена
+	Scope Scope
+	Depth int
+	Slot  int
+
+	// Shadowed - переменная внешней области с тем же именем, которая читается,
+	// пока локальной переменной функции еще ничего не присвоено
+	Shadowed *Identifier
 }
 
-func (id *Identifier) TokenLiteral() string { return id.Token.Literal }
-func (id *Identifier) expressionNode()      {}
+func (id *Identifier) TokenLiteral() string     { return id.Token.Literal }
+func (id *Identifier) Pos() token.TokenPosition { return id.Token.Pos }
+func (id *Identifier) expressionNode()          {}
 func (id *Identifier) String() string {
 	return id.Value
 }
 
+// AssignStatement присваивание Target = Value или составное Target op= Value.
+// Target - переменная, индексное выражение от переменной или образец деструктуризации:
+// ArrayLiteral из целей или HashLiteral, значения которого - цели.
+// Присваивание нескольких значений a, b = x, y представлено образцом и значением ArrayLiteral
 type AssignStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token
+	Target   Expression
+	Operator string // оператор составного присваивания без =, пустой для простого присваивания
+	Value    Expression
 }
 
-func (ls *AssignStatement) statementNode()       {}
-func (ls *AssignStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *AssignStatement) statementNode()           {}
+func (ls *AssignStatement) TokenLiteral() string     { return ls.Token.Literal }
+func (ls *AssignStatement) Pos() token.TokenPosition { return ls.Token.Pos }
 func (ls *AssignStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
-	out.WriteString(" = ")
+	out.WriteString(ls.Target.String())
+	out.WriteString(" " + ls.Operator + "= ")
 
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -80,8 +117,9 @@ type ReturnStatement struct {
 	ReturnValue Expression
 }
 
-func (rs *ReturnStatement) statementNode()       {}
-func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) statementNode()           {}
+func (rs *ReturnStatement) TokenLiteral() string     { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.TokenPosition { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -96,13 +134,40 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()           {}
+func (ts *ThrowStatement) TokenLiteral() string     { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.TokenPosition { return ts.Token.Pos }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// ImportStatement import "path" as name: загружает модуль и присваивает его переменной Name
+type ImportStatement struct {
+	Token token.Token
+	Path  string
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode()           {}
+func (is *ImportStatement) TokenLiteral() string     { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.TokenPosition { return is.Token.Pos }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " " + strconv.Quote(is.Path) + " as " + is.Name.String() + ";"
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
 }
 
-func (es *ExpressionStatement) statementNode()       {}
-func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) statementNode()           {}
+func (es *ExpressionStatement) TokenLiteral() string     { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.TokenPosition { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -113,11 +178,33 @@ func (es *ExpressionStatement) String() string {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // значение литерала, который не помещается в int64
 }
 
-func (il *IntegerLiteral) expressionNode()      {}
-func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
-func (il *IntegerLiteral) String() string       { return il.Token.Literal }
+func (il *IntegerLiteral) expressionNode()          {}
+func (il *IntegerLiteral) TokenLiteral() string     { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.TokenPosition { return il.Token.Pos }
+func (il *IntegerLiteral) String() string           { return il.Token.Literal }
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()          {}
+func (fl *FloatLiteral) TokenLiteral() string     { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.TokenPosition { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string           { return fl.Token.Literal }
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()          {}
+func (sl *StringLiteral) TokenLiteral() string     { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.TokenPosition { return sl.Token.Pos }
+func (sl *StringLiteral) String() string           { return strconv.Quote(sl.Value) }
 
 type PrefixExpression struct {
 	Token    token.Token
@@ -125,8 +212,9 @@ type PrefixExpression struct {
 	Right    Expression
 }
 
-func (pe *PrefixExpression) expressionNode()      {}
-func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) expressionNode()          {}
+func (pe *PrefixExpression) TokenLiteral() string     { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.TokenPosition { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -145,8 +233,9 @@ type InfixExpression struct {
 	Right    Expression
 }
 
-func (ie *InfixExpression) expressionNode()      {}
-func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) expressionNode()          {}
+func (ie *InfixExpression) TokenLiteral() string     { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.TokenPosition { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -164,9 +253,10 @@ type Boolean struct {
 	Value bool
 }
 
-func (b *Boolean) expressionNode()      {}
-func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
-func (b *Boolean) String() string       { return b.Token.Literal }
+func (b *Boolean) expressionNode()          {}
+func (b *Boolean) TokenLiteral() string     { return b.Token.Literal }
+func (b *Boolean) Pos() token.TokenPosition { return b.Token.Pos }
+func (b *Boolean) String() string           { return b.Token.Literal }
 
 type IfExpression struct {
 	Token       token.Token
@@ -175,8 +265,9 @@ type IfExpression struct {
 	Alternative *BlockStatement
 }
 
-func (ie *IfExpression) expressionNode()      {}
-func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) expressionNode()          {}
+func (ie *IfExpression) TokenLiteral() string     { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.TokenPosition { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -193,13 +284,45 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression значение - значение блока try или, если в нем возникла ошибка, блока catch.
+// Блок finally выполняется всегда, его значение отбрасывается
+type TryExpression struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   *Identifier // переменная с пойманной ошибкой
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()          {}
+func (te *TryExpression) TokenLiteral() string     { return te.Token.Literal }
+func (te *TryExpression) Pos() token.TokenPosition { return te.Token.Pos }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch(" + te.Param.String() + ") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
 }
 
-func (bs *BlockStatement) statementNode()       {}
-func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) statementNode()           {}
+func (bs *BlockStatement) TokenLiteral() string     { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.TokenPosition { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -214,10 +337,12 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Locals     []string // имена локальных переменных, первыми идут параметры. Заполняет resolver
 }
 
-func (fl *FunctionLiteral) expressionNode()      {}
-func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) expressionNode()          {}
+func (fl *FunctionLiteral) TokenLiteral() string     { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.TokenPosition { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -239,10 +364,12 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Tail      bool // вызов в хвостовой позиции функции, отмечается при разрешении имен
 }
 
-func (ce *CallExpression) expressionNode()      {}
-func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) expressionNode()          {}
+func (ce *CallExpression) TokenLiteral() string     { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.TokenPosition { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -263,6 +390,247 @@ type Null struct {
 	Token token.Token
 }
 
-func (n *Null) expressionNode()      {}
-func (n *Null) TokenLiteral() string { return n.Token.Literal }
-func (n *Null) String() string       { return n.Token.Literal }
+func (n *Null) expressionNode()          {}
+func (n *Null) TokenLiteral() string     { return n.Token.Literal }
+func (n *Null) Pos() token.TokenPosition { return n.Token.Pos }
+func (n *Null) String() string           { return n.Token.Literal }
+
+type ArrayLiteral struct {
+	Token    token.Token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()          {}
+func (al *ArrayLiteral) TokenLiteral() string     { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.TokenPosition { return al.Token.Pos }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token token.Token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()          {}
+func (ie *IndexExpression) TokenLiteral() string     { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.TokenPosition { return ie.Token.Pos }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// SelectorExpression обращение к переменной модуля: lib.name
+type SelectorExpression struct {
+	Token token.Token
+	Left  Expression
+	Name  string
+}
+
+func (se *SelectorExpression) expressionNode()          {}
+func (se *SelectorExpression) TokenLiteral() string     { return se.Token.Literal }
+func (se *SelectorExpression) Pos() token.TokenPosition { return se.Token.Pos }
+func (se *SelectorExpression) String() string {
+	return se.Left.String() + "." + se.Name
+}
+
+// IndexRoot возвращает выражение, к которому применяются вложенные индексы: a для a[i][j]
+func IndexRoot(exp Expression) Expression {
+	for {
+		index, ok := exp.(*IndexExpression)
+		if !ok {
+			return exp
+		}
+		exp = index.Left
+	}
+}
+
+// IndexPath возвращает переменную и индексы цели присваивания a[i][j]: a и [i, j]
+func IndexPath(target *IndexExpression) (*Identifier, []Expression) {
+	var path []Expression
+	exp := Expression(target)
+	for {
+		index, ok := exp.(*IndexExpression)
+		if !ok {
+			break
+		}
+		path = append([]Expression{index.Index}, path...)
+		exp = index.Left
+	}
+	return exp.(*Identifier), path
+}
+
+// Borrowed сообщает, что значение переменной id нужно только для доступа к элементу по индексам indices
+// и ссылка на него не сохраняется: id - переменная без внешней переменной Shadowed, а индексы
+// не вызывают функций и не могут изменить переменные. Такое значение читается без передачи
+// владения (object.Environment.Peek), и присваивание его элементу может изменить его на месте
+func Borrowed(id *Identifier, indices []Expression) bool {
+	if id.Scope == BUILTIN || id.Scope == UNRESOLVED || id.Shadowed != nil {
+		return false
+	}
+	for _, index := range indices {
+		if !pure(index) {
+			return false
+		}
+	}
+	return true
+}
+
+// LenArgument возвращает переменную x вызова len(x) встроенной функции len. len не сохраняет ссылку
+// на аргумент, поэтому x, как и переменная в Borrowed, читается без передачи владения значением
+func LenArgument(call *CallExpression) (*Identifier, bool) {
+	fn, ok := call.Function.(*Identifier)
+	if !ok || fn.Scope != BUILTIN || fn.Value != "len" || len(call.Arguments) != 1 {
+		return nil, false
+	}
+	id, ok := call.Arguments[0].(*Identifier)
+	if !ok || !Borrowed(id, nil) {
+		return nil, false
+	}
+	return id, true
+}
+
+// pure сообщает, что вычисление выражения не вызывает функций, кроме len:
+// литералы, переменные, операторы и индексы
+func pure(exp Expression) bool {
+	switch exp := exp.(type) {
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		return true
+	case *PrefixExpression:
+		return pure(exp.Right)
+	case *InfixExpression:
+		return pure(exp.Left) && pure(exp.Right)
+	case *IndexExpression:
+		return pure(exp.Left) && pure(exp.Index)
+	case *CallExpression:
+		_, ok := LenArgument(exp)
+		return ok
+	default:
+		return false
+	}
+}
+
+type HashLiteral struct {
+	Token  token.Token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (hl *HashLiteral) expressionNode()          {}
+func (hl *HashLiteral) TokenLiteral() string     { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.TokenPosition { return hl.Token.Pos }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Values[i].String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()           {}
+func (ws *WhileStatement) TokenLiteral() string     { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.TokenPosition { return ws.Token.Pos }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+type ForStatement struct {
+	Token     token.Token
+	Init      Statement
+	Condition Expression
+	Step      Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()           {}
+func (fs *ForStatement) TokenLiteral() string     { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.TokenPosition { return fs.Token.Pos }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for(")
+	if fs.Init != nil {
+		out.WriteString(fs.Init.String())
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Step != nil {
+		out.WriteString(fs.Step.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()           {}
+func (bs *BreakStatement) TokenLiteral() string     { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.TokenPosition { return bs.Token.Pos }
+func (bs *BreakStatement) String() string           { return bs.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()           {}
+func (cs *ContinueStatement) TokenLiteral() string     { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.TokenPosition { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string           { return cs.Token.Literal + ";" }
+
+type ForkExpression struct {
+	Token token.Token
+	Call  *CallExpression
+}
+
+func (fe *ForkExpression) expressionNode()          {}
+func (fe *ForkExpression) TokenLiteral() string     { return fe.Token.Literal }
+func (fe *ForkExpression) Pos() token.TokenPosition { return fe.Token.Pos }
+func (fe *ForkExpression) String() string {
+	return fe.TokenLiteral() + " " + fe.Call.String()
+}
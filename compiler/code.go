@@ -0,0 +1,261 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Instructions последовательность инструкций байт-кода.
+// Инструкция - это байт с кодом операции, за которым следуют операнды в формате big endian
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // положить на стек константу с номером из операнда
+	OpNull
+	OpTrue
+	OpFalse
+	OpPop
+	OpDup    // повторить значение на вершине стека
+	OpResult // снять со стека результат инструкции верхнего уровня программы
+	OpHalt   // завершить выполнение программы
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpIntDiv
+	OpMod
+	OpPow
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+	OpXor // ^: логическое исключающее или по истинности операндов
+	OpBitXor
+	OpBitAnd
+	OpBitOr
+	OpShiftLeft
+	OpShiftRight
+	OpMinus
+	OpBang
+	OpBitNot
+
+	OpJump
+	OpJumpNotTruthy
+	OpJumpTruthy
+
+	OpGetGlobal
+	OpSetGlobal // присваивания оставляют значение на стеке
+	OpGetLocal
+	OpSetLocal
+	OpGetFree // переменная функции, внутри которой создано замыкание: глубина и номер
+	OpSetFree
+	OpGetIfSet   // переменная по глубине и номеру, если ей присвоено значение, и переход по смещению
+	OpGetBuiltin // встроенная функция по номеру константы с ее именем
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex    // значение, контейнер и n индексов заменить значением и копией контейнера с этим элементом
+	OpUpdateIndex // то же для составного присваивания: n индексов и код бинарного оператора
+	// OpPeek, OpSetElement и OpUpdateElement работают с переменной, заданной признаком глобальной, глубиной
+	// и номером, значение которой нужно только для доступа к элементу (ast.Borrowed), и не передают владение им
+	OpPeek          // переменная для индексирования
+	OpSetElement    // значение и n индексов заменить значением, присвоив его элементу переменной
+	OpUpdateElement // значение и n индексов заменить новым значением элемента переменной после op=
+	OpUnpack        // заменить массив из n элементов его элементами, первый - на вершине стека
+	OpUnpackHash    // заменить словарь и n ключей значениями по этим ключам, первое - на вершине стека
+	OpSelect        // переменная модуля со стека по номеру константы с ее именем
+
+	OpClosure
+	OpCall     // число аргументов и номер константы с именем функции для стека вызовов
+	OpTailCall // вызов в хвостовой позиции, заменяющий кадр текущей функции
+	OpReturnValue
+	OpLoopControl // break или continue вне цикла
+	OpFork
+
+	OpTry        // установить обработчик ошибок кадра со смещением его кода, ошибку он получает на стеке
+	OpPopHandler // снять последний установленный обработчик ошибок
+	OpCatch      // заменить ошибку на стеке значением переменной catch
+	OpThrow      // бросить значение со стека как ошибку, ошибку - дальше как есть
+
+	OpImport // загрузить модуль по номеру константы с путем
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpNull:     {"OpNull", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+	OpResult:   {"OpResult", []int{}},
+	OpHalt:     {"OpHalt", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpIntDiv:       {"OpIntDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLess:         {"OpLess", []int{}},
+	OpGreater:      {"OpGreater", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpXor:          {"OpXor", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	OpBitNot:       {"OpBitNot", []int{}},
+
+	OpJump:          {"OpJump", []int{4}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{4}},
+	OpJumpTruthy:    {"OpJumpTruthy", []int{4}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{2}},
+	OpSetLocal:  {"OpSetLocal", []int{2}},
+	OpGetFree:   {"OpGetFree", []int{1, 2}},
+	OpSetFree:   {"OpSetFree", []int{1, 2}},
+	OpGetIfSet:  {"OpGetIfSet", []int{1, 2, 4}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{2}},
+
+	OpArray:         {"OpArray", []int{2}},
+	OpHash:          {"OpHash", []int{2}},
+	OpIndex:         {"OpIndex", []int{}},
+	OpSetIndex:      {"OpSetIndex", []int{1}},
+	OpUpdateIndex:   {"OpUpdateIndex", []int{1, 1}},
+	OpPeek:          {"OpPeek", []int{1, 1, 2}},
+	OpSetElement:    {"OpSetElement", []int{1, 1, 1, 2}},
+	OpUpdateElement: {"OpUpdateElement", []int{1, 1, 1, 1, 2}},
+	OpUnpack:        {"OpUnpack", []int{2}},
+	OpUnpackHash:    {"OpUnpackHash", []int{2}},
+	OpSelect:        {"OpSelect", []int{2}},
+
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{1, 2}},
+	OpTailCall:    {"OpTailCall", []int{1, 2}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpLoopControl: {"OpLoopControl", []int{1}},
+	OpFork:        {"OpFork", []int{1}},
+
+	OpTry:        {"OpTry", []int{4}},
+	OpPopHandler: {"OpPopHandler", []int{}},
+	OpCatch:      {"OpCatch", []int{}},
+	OpThrow:      {"OpThrow", []int{}},
+
+	OpImport: {"OpImport", []int{2}},
+}
+
+// Операнды OpLoopControl
+const (
+	LoopBreak = iota
+	LoopContinue
+)
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make собирает инструкцию из кода операции и операндов
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	length := 1
+	for _, w := range def.OperandWidths {
+		length += w
+	}
+
+	instruction := make([]byte, length)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 1:
+			instruction[offset] = byte(o)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands разбирает операнды инструкции и возвращает их вместе с числом прочитанных байт
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(ins[offset])
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 { return binary.BigEndian.Uint16(ins) }
+func ReadUint32(ins Instructions) uint32 { return binary.BigEndian.Uint32(ins) }
+
+// String дизассемблирует инструкции: по одной на строку вместе со смещением
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(ins); {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&out, " %d", o)
+		}
+		out.WriteString("\n")
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
@@ -0,0 +1,927 @@
+package compiler
+
+/*
+	Модуль, переводящий абстрактное синтаксическое дерево программы в байт-код для виртуальной машины (пакет vm).
+	Основная функция Compile компилирует программу, результат возвращает Bytecode
+*/
+
+import (
+	"fmt"
+	"mlang/ast"
+	"mlang/object"
+	"mlang/token"
+)
+
+const (
+	MAX_CONSTANTS = 1 << 16
+	MAX_LOCALS    = 1 << 16
+	MAX_ARGUMENTS = 1 << 8
+	MAX_DEPTH     = 1<<8 - 1 // глубина вложенности функций для OpGetFree
+)
+
+// Bytecode результат компиляции: основная программа и пул констант
+type Bytecode struct {
+	Main      *object.CompiledFunction
+	Constants []object.Object
+}
+
+type Compiler struct {
+	constants []object.Object
+	strings   map[string]int // номера строковых констант с именами функций, модулей и их переменных
+	scope     *scope
+	main      *object.CompiledFunction
+	functions []*object.CompiledFunction // функции, скомпилированные в Compile, получают его пул констант
+
+	pos     token.TokenPosition // позиция узла, для которого генерируются инструкции
+	stmtPos token.TokenPosition // позиция инструкции верхнего уровня
+}
+
+func New() *Compiler {
+	return NewWithState([]object.Object{})
+}
+
+// NewWithState создает компилятор, продолжающий нумерацию констант предыдущей компиляции.
+// Используется в интерактивном режиме
+func NewWithState(constants []object.Object) *Compiler {
+	return &Compiler{
+		constants: constants,
+		strings:   make(map[string]int),
+		scope:     newScope(nil),
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{Main: c.main, Constants: c.constants}
+}
+
+// Compile компилирует программу, имена которой уже разрешены (пакет resolver). Результат каждой инструкции верхнего уровня сохраняется как результат программы
+func (c *Compiler) Compile(program *ast.Program) error {
+	for _, stmt := range program.Statements {
+		c.stmtPos = stmt.Pos()
+		if err := c.compile(stmt); err != nil {
+			return err
+		}
+		c.emit(OpResult)
+	}
+	c.emit(OpHalt)
+
+	c.main = &object.CompiledFunction{
+		Instructions: c.scope.instructions,
+		SourceMap:    c.scope.sourceMap,
+	}
+	c.functions = append(c.functions, c.main)
+	for _, fn := range c.functions {
+		fn.Constants = c.constants
+	}
+	c.functions = nil
+	return nil
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	pos := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = pos }()
+
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return c.compile(node.Expression)
+	case *ast.AssignStatement:
+		return c.compileAssignStatement(node)
+	case *ast.BlockStatement:
+		return c.compileBlock(node)
+	case *ast.ReturnStatement:
+		if err := c.compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.compileExit(true); err != nil {
+			return err
+		}
+		if c.scope.outer == nil {
+			// return вне функции завершает программу, а его значение становится последним результатом
+			c.emit(OpResult)
+			c.emit(OpHalt)
+		} else {
+			c.emit(OpReturnValue)
+		}
+		c.scope.depth++
+	case *ast.WhileStatement:
+		return c.compileWhile(node)
+	case *ast.ForStatement:
+		return c.compileFor(node)
+	case *ast.BreakStatement:
+		return c.compileLoopControl(LoopBreak)
+	case *ast.ContinueStatement:
+		return c.compileLoopControl(LoopContinue)
+	case *ast.ThrowStatement:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(OpThrow)
+		// как и после return, следующие инструкции недостижимы
+		c.scope.depth++
+	case *ast.TryExpression:
+		return c.compileTry(node)
+	case *ast.ImportStatement:
+		idx, err := c.addString(node.Path)
+		if err != nil {
+			return err
+		}
+		c.emit(OpImport, idx)
+		return c.compileAssign(node.Name)
+	case *ast.Identifier:
+		return c.compileIdentifier(node)
+	case *ast.Null:
+		c.emit(OpNull)
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return c.emitConstant(&object.BigInt{Value: node.Big})
+		}
+		return c.emitConstant(&object.Integer{Value: node.Value})
+	case *ast.FloatLiteral:
+		return c.emitConstant(&object.Float{Value: node.Value})
+	case *ast.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value})
+	case *ast.PrefixExpression:
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "-":
+			c.emit(OpMinus)
+		case "!":
+			c.emit(OpBang)
+		case "~":
+			c.emit(OpBitNot)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		return c.compileInfix(node)
+	case *ast.IfExpression:
+		return c.compileIf(node)
+	case *ast.ArrayLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for i := range node.Keys {
+			if err := c.compile(node.Keys[i]); err != nil {
+				return err
+			}
+			if err := c.compile(node.Values[i]); err != nil {
+				return err
+			}
+		}
+		c.emit(OpHash, len(node.Keys))
+	case *ast.IndexExpression:
+		if id, ok := node.Left.(*ast.Identifier); ok && ast.Borrowed(id, []ast.Expression{node.Index}) {
+			if err := c.checkSlot(id); err != nil {
+				return err
+			}
+			c.emit(OpPeek, variableOperands(id)...)
+		} else if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(OpIndex)
+	case *ast.SelectorExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		idx, err := c.addString(node.Name)
+		if err != nil {
+			return err
+		}
+		c.emit(OpSelect, idx)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node)
+	case *ast.CallExpression:
+		return c.compileCall(node)
+	case *ast.ForkExpression:
+		if err := c.compile(node.Call.Function); err != nil {
+			return err
+		}
+		if err := c.compileArguments(node.Call.Arguments); err != nil {
+			return err
+		}
+		c.emit(OpFork, len(node.Call.Arguments))
+	default:
+		return fmt.Errorf("can not compile %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileExpressions(exps []ast.Expression) error {
+	for _, e := range exps {
+		if err := c.compile(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileArguments(args []ast.Expression) error {
+	if len(args) >= MAX_ARGUMENTS {
+		return fmt.Errorf("%s: too many arguments: %d", c.pos, len(args))
+	}
+	return c.compileExpressions(args)
+}
+
+// compileBlock оставляет на стеке значение последней инструкции блока или null для пустого блока
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	if len(block.Statements) == 0 {
+		c.emit(OpNull)
+		return nil
+	}
+
+	for i, stmt := range block.Statements {
+		if i > 0 {
+			c.emit(OpPop)
+		}
+		if err := c.compile(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileAssignStatement компилирует присваивание, оставляющее на стеке присвоенное значение
+func (c *Compiler) compileAssignStatement(node *ast.AssignStatement) error {
+	if node.Operator != "" {
+		return c.compileCompoundAssign(node)
+	}
+
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+	if id, ok := node.Target.(*ast.Identifier); ok {
+		return c.compileAssign(id)
+	}
+	c.emit(OpDup)
+	return c.compileAssignTop(node.Target)
+}
+
+// compileCompoundAssign компилирует x op= value так же, как вычислитель: переменная читается
+// до вычисления значения, индексы элемента вычисляются после значения
+func (c *Compiler) compileCompoundAssign(node *ast.AssignStatement) error {
+	op, ok := binaryOpcodes[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s=", node.Operator)
+	}
+
+	if id, ok := node.Target.(*ast.Identifier); ok {
+		if err := c.compileIdentifier(id); err != nil {
+			return err
+		}
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(op)
+		return c.compileAssign(id)
+	}
+
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+	if root, path := ast.IndexPath(node.Target.(*ast.IndexExpression)); ast.Borrowed(root, path) {
+		if err := c.compileElementTarget(root, path); err != nil {
+			return err
+		}
+		c.emit(OpUpdateElement, append([]int{len(path), int(op)}, variableOperands(root)...)...)
+		return nil
+	}
+	root, n, err := c.compileIndexTarget(node.Target.(*ast.IndexExpression))
+	if err != nil {
+		return err
+	}
+	c.emit(OpUpdateIndex, n, int(op))
+	if err := c.compileAssign(root); err != nil {
+		return err
+	}
+	c.emit(OpPop)
+	return nil
+}
+
+// compileAssignTop присваивает цели значение с вершины стека и снимает его
+func (c *Compiler) compileAssignTop(target ast.Expression) error {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		if err := c.compileAssign(target); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+	case *ast.IndexExpression:
+		if root, path := ast.IndexPath(target); ast.Borrowed(root, path) {
+			if err := c.compileElementTarget(root, path); err != nil {
+				return err
+			}
+			c.emit(OpSetElement, append([]int{len(path)}, variableOperands(root)...)...)
+			c.emit(OpPop)
+			return nil
+		}
+		root, n, err := c.compileIndexTarget(target)
+		if err != nil {
+			return err
+		}
+		c.emit(OpSetIndex, n)
+		if err := c.compileAssign(root); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+		c.emit(OpPop)
+	case *ast.ArrayLiteral:
+		c.emit(OpUnpack, len(target.Elements))
+		for _, element := range target.Elements {
+			if err := c.compileAssignTop(element); err != nil {
+				return err
+			}
+		}
+	case *ast.HashLiteral:
+		if err := c.compileExpressions(target.Keys); err != nil {
+			return err
+		}
+		c.emit(OpUnpackHash, len(target.Keys))
+		for _, value := range target.Values {
+			if err := c.compileAssignTop(value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: cannot assign to %s", target.Pos(), target.String())
+	}
+	return nil
+}
+
+// compileIndexTarget кладет на стек значение переменной a и индексы цели a[i][j],
+// возвращает переменную и число индексов
+func (c *Compiler) compileIndexTarget(target *ast.IndexExpression) (*ast.Identifier, int, error) {
+	var path []ast.Expression
+	for exp := ast.Expression(target); ; {
+		index, ok := exp.(*ast.IndexExpression)
+		if !ok {
+			break
+		}
+		path = append([]ast.Expression{index.Index}, path...)
+		exp = index.Left
+	}
+	if len(path) >= MAX_ARGUMENTS {
+		return nil, 0, fmt.Errorf("%s: too many nested indexes", target.Pos())
+	}
+
+	root := ast.IndexRoot(target).(*ast.Identifier)
+	if err := c.compileIdentifier(root); err != nil {
+		return nil, 0, err
+	}
+	if err := c.compileExpressions(path); err != nil {
+		return nil, 0, err
+	}
+	return root, len(path), nil
+}
+
+// compileElementTarget вычисляет индексы цели root[i][j], значение которой изменяется без чтения переменной
+// (OpSetElement и OpUpdateElement)
+func (c *Compiler) compileElementTarget(root *ast.Identifier, path []ast.Expression) error {
+	if len(path) >= MAX_ARGUMENTS {
+		return fmt.Errorf("%s: too many nested indexes", root.Pos())
+	}
+	if err := c.checkSlot(root); err != nil {
+		return err
+	}
+	return c.compileExpressions(path)
+}
+
+// variableOperands операнды переменной для OpPeek, OpSetElement и OpUpdateElement
+func variableOperands(id *ast.Identifier) []int {
+	if id.Scope == ast.GLOBAL {
+		return []int{1, 0, id.Slot}
+	}
+	return []int{0, id.Depth, id.Slot}
+}
+
+func (c *Compiler) compileAssign(name *ast.Identifier) error {
+	if err := c.checkSlot(name); err != nil {
+		return err
+	}
+	switch {
+	case name.Scope == ast.GLOBAL:
+		c.emit(OpSetGlobal, name.Slot)
+	case name.Depth == 0:
+		c.emit(OpSetLocal, name.Slot)
+	default:
+		c.emit(OpSetFree, name.Depth, name.Slot)
+	}
+	return nil
+}
+
+// compileIdentifier выбирает инструкцию по виду переменной, найденному при разрешении имен.
+// Глобальная переменная без значения во время выполнения ищется среди встроенных функций
+func (c *Compiler) compileIdentifier(id *ast.Identifier) error {
+	switch id.Scope {
+	case ast.BUILTIN:
+		idx, err := c.addString(id.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(OpGetBuiltin, idx)
+		return nil
+	case ast.UNRESOLVED:
+		return fmt.Errorf("%s: unresolved identifier %s", id.Pos(), id.Value)
+	}
+
+	if err := c.checkSlot(id); err != nil {
+		return err
+	}
+	if id.Shadowed != nil {
+		return c.compileShadowing(id)
+	}
+	switch {
+	case id.Scope == ast.GLOBAL:
+		c.emit(OpGetGlobal, id.Slot)
+	case id.Depth == 0:
+		c.emit(OpGetLocal, id.Slot)
+	default:
+		c.emit(OpGetFree, id.Depth, id.Slot)
+	}
+	return nil
+}
+
+// compileShadowing читает локальную переменную, а если ей еще ничего не присвоено -
+// внешнюю переменную с тем же именем
+func (c *Compiler) compileShadowing(id *ast.Identifier) error {
+	pos := c.emit(OpGetIfSet, id.Depth, id.Slot, 0)
+	if err := c.compileIdentifier(id.Shadowed); err != nil {
+		return err
+	}
+	copy(c.scope.instructions[pos:], Make(OpGetIfSet, id.Depth, id.Slot, len(c.scope.instructions)))
+	return nil
+}
+
+// checkSlot проверяет, что номер и глубина переменной помещаются в операнды инструкций
+func (c *Compiler) checkSlot(id *ast.Identifier) error {
+	if id.Slot >= MAX_LOCALS {
+		return fmt.Errorf("%s: too many variables", id.Pos())
+	}
+	if id.Scope == ast.LOCAL && id.Depth > MAX_DEPTH {
+		return fmt.Errorf("%s: too deeply nested functions", id.Pos())
+	}
+	return nil
+}
+
+// binaryOpcodes инструкции бинарных операторов, кроме && и ||
+var binaryOpcodes = map[string]Opcode{
+	"+":  OpAdd,
+	"-":  OpSub,
+	"*":  OpMul,
+	"/":  OpDiv,
+	"~/": OpIntDiv,
+	"%":  OpMod,
+	"**": OpPow,
+	"==": OpEqual,
+	"!=": OpNotEqual,
+	"<":  OpLess,
+	">":  OpGreater,
+	"<=": OpLessEqual,
+	">=": OpGreaterEqual,
+	"^":  OpXor,
+	"~":  OpBitXor,
+	"&":  OpBitAnd,
+	"|":  OpBitOr,
+	"<<": OpShiftLeft,
+	">>": OpShiftRight,
+}
+
+func (c *Compiler) compileInfix(node *ast.InfixExpression) error {
+	if node.Operator == "&&" || node.Operator == "||" {
+		return c.compileLogical(node)
+	}
+	op, ok := binaryOpcodes[node.Operator]
+	if !ok {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+	c.emit(op)
+	return nil
+}
+
+// compileLogical компилирует && и || с сокращенным вычислением: правый операнд вычисляется,
+// только если левый не определил результат. Результат - логическое значение
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	// для && результат решает ложный операнд, для || - истинный
+	jumpOp, decided, otherwise := OpJumpNotTruthy, OpFalse, OpTrue
+	if node.Operator == "||" {
+		jumpOp, decided, otherwise = OpJumpTruthy, OpTrue, OpFalse
+	}
+
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	jumpLeft := c.emit(jumpOp, 0)
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+	jumpRight := c.emit(jumpOp, 0)
+	c.emit(otherwise)
+	end := c.emit(OpJump, 0)
+	c.scope.depth--
+
+	c.changeOperand(jumpLeft, len(c.scope.instructions))
+	c.changeOperand(jumpRight, len(c.scope.instructions))
+	c.emit(decided)
+	c.changeOperand(end, len(c.scope.instructions))
+	return nil
+}
+
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(OpJumpNotTruthy, 0)
+
+	if err := c.compile(node.Consequence); err != nil {
+		return err
+	}
+	jump := c.emit(OpJump, 0)
+	// значение на стеке оставляет только одна из ветвей
+	c.scope.depth--
+
+	c.changeOperand(jumpNotTruthy, len(c.scope.instructions))
+	if node.Alternative != nil {
+		if err := c.compile(node.Alternative); err != nil {
+			return err
+		}
+	} else {
+		c.emit(OpNull)
+	}
+	c.changeOperand(jump, len(c.scope.instructions))
+
+	return nil
+}
+
+func (c *Compiler) compileWhile(node *ast.WhileStatement) error {
+	start := len(c.scope.instructions)
+	l := c.enterLoop()
+
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	exit := c.emit(OpJumpNotTruthy, 0)
+
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(OpPop)
+	c.emit(OpJump, start)
+
+	c.leaveLoop(l, start)
+	c.changeOperand(exit, len(c.scope.instructions))
+	c.emit(OpNull)
+	return nil
+}
+
+func (c *Compiler) compileFor(node *ast.ForStatement) error {
+	if node.Init != nil {
+		if err := c.compile(node.Init); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+	}
+
+	start := len(c.scope.instructions)
+	l := c.enterLoop()
+
+	exit := -1
+	if node.Condition != nil {
+		if err := c.compile(node.Condition); err != nil {
+			return err
+		}
+		exit = c.emit(OpJumpNotTruthy, 0)
+	}
+
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(OpPop)
+
+	step := len(c.scope.instructions)
+	if node.Step != nil {
+		if err := c.compile(node.Step); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+	}
+	c.emit(OpJump, start)
+
+	c.leaveLoop(l, step)
+	if exit >= 0 {
+		c.changeOperand(exit, len(c.scope.instructions))
+	}
+	c.emit(OpNull)
+	return nil
+}
+
+func (c *Compiler) enterLoop() *loop {
+	l := &loop{depth: c.scope.depth}
+	c.scope.loops = append(c.scope.loops, l)
+	return l
+}
+
+// leaveLoop направляет continue на continueTarget, а break - на конец цикла
+func (c *Compiler) leaveLoop(l *loop, continueTarget int) {
+	c.scope.loops = c.scope.loops[:len(c.scope.loops)-1]
+	for _, pos := range l.continues {
+		c.changeOperand(pos, continueTarget)
+	}
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.scope.instructions))
+	}
+}
+
+// compileLoopControl снимает со стека значения, накопленные с начала итерации, и переходит
+// в конец или к следующей итерации цикла. break и continue вне цикла становятся ошибкой выполнения
+func (c *Compiler) compileLoopControl(kind int) error {
+	depth := c.scope.depth
+	defer func() { c.scope.depth = depth + 1 }()
+
+	if len(c.scope.loops) == 0 {
+		if err := c.compileExit(false); err != nil {
+			return err
+		}
+		if c.scope.outer == nil {
+			c.pos = c.stmtPos
+		}
+		c.emit(OpLoopControl, kind)
+		return nil
+	}
+
+	l := c.scope.loops[len(c.scope.loops)-1]
+	for i := l.depth; i < depth; i++ {
+		c.emit(OpPop)
+	}
+	if err := c.compileExit(false); err != nil {
+		return err
+	}
+
+	jump := c.emit(OpJump, 0)
+	if kind == LoopBreak {
+		l.breaks = append(l.breaks, jump)
+	} else {
+		l.continues = append(l.continues, jump)
+	}
+	return nil
+}
+
+// compileTry устанавливает обработчики ошибок для catch и finally на время выполнения блоков.
+// Обработчик catch получает ошибку на стеке вместо значения блока try. Блок finally компилируется
+// после обычного завершения try, в обработчике ошибки, которую затем бросает дальше,
+// и перед каждым return, break и continue, выходящими из try (compileExit)
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	depth := c.scope.depth
+	t := &tryBlock{finally: node.Finally, loops: len(c.scope.loops)}
+	c.scope.tries = append(c.scope.tries, t)
+
+	finallyHandler, catchHandler := -1, -1
+	if node.Finally != nil {
+		finallyHandler = c.emit(OpTry, 0)
+		t.handlers++
+	}
+	if node.Catch != nil {
+		catchHandler = c.emit(OpTry, 0)
+		t.handlers++
+	}
+
+	if err := c.compile(node.Block); err != nil {
+		return err
+	}
+
+	if node.Catch != nil {
+		c.emit(OpPopHandler)
+		t.handlers--
+		jump := c.emit(OpJump, 0)
+
+		c.changeOperand(catchHandler, len(c.scope.instructions))
+		c.scope.depth = depth + 1
+		c.emit(OpCatch)
+		if err := c.compileAssign(node.Param); err != nil {
+			return err
+		}
+		c.emit(OpPop)
+		if err := c.compile(node.Catch); err != nil {
+			return err
+		}
+		c.changeOperand(jump, len(c.scope.instructions))
+	}
+
+	c.scope.tries = c.scope.tries[:len(c.scope.tries)-1]
+	if node.Finally == nil {
+		return nil
+	}
+
+	c.emit(OpPopHandler)
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	jump := c.emit(OpJump, 0)
+
+	c.changeOperand(finallyHandler, len(c.scope.instructions))
+	c.scope.depth = depth + 1
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	c.emit(OpThrow)
+	c.scope.depth = depth + 1
+	c.changeOperand(jump, len(c.scope.instructions))
+	return nil
+}
+
+// compileFinally выполняет блок finally, не меняя стек: его значение отбрасывается
+func (c *Compiler) compileFinally(block *ast.BlockStatement) error {
+	if err := c.compile(block); err != nil {
+		return err
+	}
+	c.emit(OpPop)
+	return nil
+}
+
+// compileExit снимает обработчики ошибок блоков try, из которых выходит return (all)
+// или break и continue (блоки внутри текущего цикла), и выполняет их finally от внутреннего к внешнему
+func (c *Compiler) compileExit(all bool) error {
+	tries := c.scope.tries
+	defer func() { c.scope.tries = tries }()
+
+	for i := len(tries) - 1; i >= 0; i-- {
+		t := tries[i]
+		if !all && t.loops < len(c.scope.loops) {
+			break
+		}
+		for j := 0; j < t.handlers; j++ {
+			c.emit(OpPopHandler)
+		}
+		if t.finally != nil {
+			// return, break и continue внутри finally выходят уже из внешних блоков
+			c.scope.tries = tries[:i]
+			if err := c.compileFinally(t.finally); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral) error {
+	if len(node.Locals) > MAX_LOCALS {
+		return fmt.Errorf("%s: too many local variables", c.pos)
+	}
+	c.scope = newScope(c.scope)
+	params := make([]string, len(node.Parameters))
+	for i, p := range node.Parameters {
+		params[i] = p.Value
+	}
+
+	if err := c.compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(OpReturnValue)
+
+	fn := &object.CompiledFunction{
+		Instructions: c.scope.instructions,
+		SourceMap:    c.scope.sourceMap,
+		Parameters:   params,
+		Locals:       node.Locals,
+	}
+	c.scope = c.scope.outer
+	c.functions = append(c.functions, fn)
+
+	idx, err := c.addConstant(fn)
+	if err != nil {
+		return err
+	}
+	c.emit(OpClosure, idx)
+	return nil
+}
+
+func (c *Compiler) compileCall(node *ast.CallExpression) error {
+	if err := c.compile(node.Function); err != nil {
+		return err
+	}
+	if id, ok := ast.LenArgument(node); ok {
+		if err := c.checkSlot(id); err != nil {
+			return err
+		}
+		c.emit(OpPeek, variableOperands(id)...)
+	} else if err := c.compileArguments(node.Arguments); err != nil {
+		return err
+	}
+
+	name, err := c.functionName(node.Function)
+	if err != nil {
+		return err
+	}
+	if node.Tail {
+		c.emit(OpTailCall, len(node.Arguments), name)
+	} else {
+		c.emit(OpCall, len(node.Arguments), name)
+	}
+	return nil
+}
+
+// functionName возвращает номер константы с именем вызываемой функции для стека вызовов
+func (c *Compiler) functionName(callee ast.Expression) (int, error) {
+	name := "<anonymous>"
+	switch callee := callee.(type) {
+	case *ast.Identifier:
+		name = callee.Value
+	case *ast.IndexExpression, *ast.SelectorExpression:
+		name = callee.String()
+	}
+
+	return c.addString(name)
+}
+
+// addString добавляет строковую константу с именем, одинаковые имена используют одну константу
+func (c *Compiler) addString(name string) (int, error) {
+	if idx, ok := c.strings[name]; ok {
+		return idx, nil
+	}
+	idx, err := c.addConstant(&object.String{Value: name})
+	if err != nil {
+		return 0, err
+	}
+	c.strings[name] = idx
+	return idx, nil
+}
+
+func (c *Compiler) emitConstant(obj object.Object) error {
+	idx, err := c.addConstant(obj)
+	if err != nil {
+		return err
+	}
+	c.emit(OpConstant, idx)
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) >= MAX_CONSTANTS {
+		return 0, fmt.Errorf("%s: too many constants", c.pos)
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+// emit добавляет инструкцию в текущую функцию и возвращает ее смещение
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	s := c.scope
+	pos := len(s.instructions)
+	if n := len(s.sourceMap); n == 0 || s.sourceMap[n-1].Pos != c.pos {
+		s.sourceMap = append(s.sourceMap, object.SourceMapEntry{Offset: pos, Pos: c.pos})
+	}
+	s.instructions = append(s.instructions, Make(op, operands...)...)
+	s.depth += stackEffect(op, operands)
+	return pos
+}
+
+func (c *Compiler) changeOperand(pos int, operand int) {
+	op := Opcode(c.scope.instructions[pos])
+	copy(c.scope.instructions[pos:], Make(op, operand))
+}
+
+// stackEffect изменение числа значений на стеке после выполнения инструкции
+func stackEffect(op Opcode, operands []int) int {
+	switch op {
+	case OpConstant, OpNull, OpTrue, OpFalse, OpDup, OpGetGlobal, OpGetLocal, OpGetFree, OpGetBuiltin, OpClosure, OpImport, OpPeek:
+		return 1
+	case OpPop, OpResult, OpJumpNotTruthy, OpJumpTruthy, OpIndex, OpReturnValue, OpThrow,
+		OpAdd, OpSub, OpMul, OpDiv, OpIntDiv, OpMod, OpPow, OpEqual, OpNotEqual, OpLess, OpGreater,
+		OpLessEqual, OpGreaterEqual, OpXor, OpBitXor, OpBitAnd, OpBitOr, OpShiftLeft, OpShiftRight:
+		return -1
+	case OpArray:
+		return 1 - operands[0]
+	case OpHash:
+		return 1 - 2*operands[0]
+	case OpSetIndex, OpUpdateIndex, OpSetElement, OpUpdateElement:
+		return -operands[0]
+	case OpUnpack:
+		return operands[0] - 1
+	case OpUnpackHash:
+		return -1
+	case OpCall, OpTailCall, OpFork:
+		return -operands[0]
+	default:
+		return 0
+	}
+}
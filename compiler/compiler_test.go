@@ -0,0 +1,355 @@
+package compiler
+
+import (
+	"mlang/lexer"
+	"mlang/object"
+	"mlang/parser"
+	"mlang/resolver"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, input string) *Bytecode {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser errors: %q", errors)
+	}
+
+	if errors := resolver.Resolve(program, object.NewEnvironment()); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+
+	c := New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return c.Bytecode()
+}
+
+func concat(instructions ...[]byte) string {
+	var out []byte
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return Instructions(out).String()
+}
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetFree, []int{2, 257}, []byte{byte(OpGetFree), 2, 1, 1}},
+		{OpJump, []int{65536}, []byte{byte(OpJump), 0, 1, 0, 0}},
+	}
+
+	for i, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+		if string(instruction) != string(tt.expected) {
+			t.Errorf("tests[%d] instruction should be %v, got %v", i, tt.expected, instruction)
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	ins := Instructions(append(append(Make(OpConstant, 1), Make(OpCall, 2, 3)...), Make(OpPop)...))
+	expected := "0000 OpConstant 1\n0003 OpCall 2 3\n0007 OpPop\n"
+
+	if ins.String() != expected {
+		t.Errorf("instructions should be %q, got %q", expected, ins.String())
+	}
+}
+
+func TestCompileProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", concat(
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpAdd),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"x = -1; x", concat(
+			Make(OpConstant, 0),
+			Make(OpMinus),
+			Make(OpSetGlobal, 0),
+			Make(OpResult),
+			Make(OpGetGlobal, 0),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"x, y = 1, 2", concat(
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpArray, 2),
+			Make(OpDup),
+			Make(OpUnpack, 2),
+			Make(OpSetGlobal, 0),
+			Make(OpPop),
+			Make(OpSetGlobal, 1),
+			Make(OpPop),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"x = []; x[0] += 1", concat(
+			Make(OpArray, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpResult),
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpUpdateElement, 1, int(OpAdd), 1, 0, 0),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"x = []; x[first(x)] += 1", concat(
+			Make(OpArray, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpResult),
+			Make(OpConstant, 0),
+			Make(OpGetGlobal, 0),
+			Make(OpGetBuiltin, 1),
+			Make(OpGetGlobal, 0),
+			Make(OpCall, 1, 1),
+			Make(OpUpdateIndex, 1, int(OpAdd)),
+			Make(OpSetGlobal, 0),
+			Make(OpPop),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"x = []; x[len(x)] += 1", concat(
+			Make(OpArray, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpResult),
+			Make(OpConstant, 0),
+			Make(OpGetBuiltin, 1),
+			Make(OpPeek, 1, 0, 0),
+			Make(OpCall, 1, 1),
+			Make(OpUpdateElement, 1, int(OpAdd), 1, 0, 0),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"x = []; x[0] = x[1]", concat(
+			Make(OpArray, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpResult),
+			Make(OpPeek, 1, 0, 0),
+			Make(OpConstant, 0),
+			Make(OpIndex),
+			Make(OpDup),
+			Make(OpConstant, 1),
+			Make(OpSetElement, 1, 1, 0, 0),
+			Make(OpPop),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"if (true) { 1 }", concat(
+			Make(OpTrue),
+			Make(OpJumpNotTruthy, 14),
+			Make(OpConstant, 0),
+			Make(OpJump, 15),
+			Make(OpNull),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"true || false", concat(
+			Make(OpTrue),
+			Make(OpJumpTruthy, 18),
+			Make(OpFalse),
+			Make(OpJumpTruthy, 18),
+			Make(OpFalse),
+			Make(OpJump, 19),
+			Make(OpTrue),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"try { 1 } catch (e) { e }", concat(
+			Make(OpTry, 14),
+			Make(OpConstant, 0),
+			Make(OpPopHandler),
+			Make(OpJump, 22),
+			Make(OpCatch),
+			Make(OpSetGlobal, 0),
+			Make(OpPop),
+			Make(OpGetGlobal, 0),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"try { 1 } finally { 2 }", concat(
+			Make(OpTry, 18),
+			Make(OpConstant, 0),
+			Make(OpPopHandler),
+			Make(OpConstant, 1),
+			Make(OpPop),
+			Make(OpJump, 23),
+			Make(OpConstant, 2),
+			Make(OpPop),
+			Make(OpThrow),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{`import "lib.mlang" as lib; lib.f`, concat(
+			Make(OpImport, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpResult),
+			Make(OpGetGlobal, 0),
+			Make(OpSelect, 1),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"while (true) { break }", concat(
+			Make(OpTrue),
+			Make(OpJumpNotTruthy, 17),
+			Make(OpJump, 17),
+			Make(OpPop),
+			Make(OpJump, 0),
+			Make(OpNull),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"while (true) { 1 + if (true) { continue } else { 2 } }", concat(
+			Make(OpTrue),
+			Make(OpJumpNotTruthy, 36),
+			Make(OpConstant, 0),
+			Make(OpTrue),
+			Make(OpJumpNotTruthy, 26),
+			Make(OpPop),
+			Make(OpJump, 0),
+			Make(OpJump, 29),
+			Make(OpConstant, 1),
+			Make(OpAdd),
+			Make(OpPop),
+			Make(OpJump, 0),
+			Make(OpNull),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"break", concat(
+			Make(OpLoopControl, LoopBreak),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"return 1; 2", concat(
+			Make(OpConstant, 0),
+			Make(OpResult),
+			Make(OpHalt),
+			Make(OpResult),
+			Make(OpConstant, 1),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"[1, {2: 3}][0]", concat(
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpConstant, 2),
+			Make(OpHash, 1),
+			Make(OpArray, 2),
+			Make(OpConstant, 3),
+			Make(OpIndex),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+		{"len([]); fork len([])", concat(
+			Make(OpGetBuiltin, 0),
+			Make(OpArray, 0),
+			Make(OpCall, 1, 0),
+			Make(OpResult),
+			Make(OpGetBuiltin, 0),
+			Make(OpArray, 0),
+			Make(OpFork, 1),
+			Make(OpResult),
+			Make(OpHalt),
+		)},
+	}
+
+	for i, tt := range tests {
+		bytecode := compile(t, tt.input)
+		actual := Instructions(bytecode.Main.Instructions).String()
+		if actual != tt.expected {
+			t.Errorf("tests[%d] instructions of %q should be\n%s\ngot\n%s", i, tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestCompileFunctions(t *testing.T) {
+	input := `x = 1
+	f = func(a) {
+		b = a + x
+		g = func() { a + b }
+		g()
+	}`
+
+	bytecode := compile(t, input)
+
+	var functions []*object.CompiledFunction
+	for _, c := range bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			functions = append(functions, fn)
+		}
+	}
+	if len(functions) != 2 {
+		t.Fatalf("constants should have 2 functions, got %d", len(functions))
+	}
+
+	g, f := functions[0], functions[1]
+	tests := []struct {
+		fn       *object.CompiledFunction
+		locals   []string
+		expected string
+	}{
+		{g, nil, concat(
+			Make(OpGetFree, 1, 0),
+			Make(OpGetFree, 1, 1),
+			Make(OpAdd),
+			Make(OpReturnValue),
+		)},
+		{f, []string{"a", "b", "g"}, concat(
+			Make(OpGetLocal, 0),
+			Make(OpGetGlobal, 0),
+			Make(OpAdd),
+			Make(OpSetLocal, 1),
+			Make(OpPop),
+			Make(OpClosure, 1),
+			Make(OpSetLocal, 2),
+			Make(OpPop),
+			Make(OpGetLocal, 2),
+			Make(OpTailCall, 0, 2),
+			Make(OpReturnValue),
+		)},
+	}
+
+	for i, tt := range tests {
+		if strings.Join(tt.fn.Locals, " ") != strings.Join(tt.locals, " ") {
+			t.Errorf("tests[%d] locals should be %v, got %v", i, tt.locals, tt.fn.Locals)
+		}
+		actual := Instructions(tt.fn.Instructions).String()
+		if actual != tt.expected {
+			t.Errorf("tests[%d] instructions should be\n%s\ngot\n%s", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	bytecode := compile(t, "x = 1\ny = x / 0")
+	ins := bytecode.Main.Instructions
+
+	for offset := 0; offset < len(ins); {
+		def, _ := Lookup(ins[offset])
+		if Opcode(ins[offset]) == OpDiv {
+			// OpDiv относится к инфиксному выражению, позиция которого - позиция оператора
+			if pos := bytecode.Main.Pos(offset).String(); pos != "2:7" {
+				t.Errorf("OpDiv position should be 2:7, got %s", pos)
+			}
+			return
+		}
+		_, read := ReadOperands(def, ins[offset+1:])
+		offset += 1 + read
+	}
+	t.Fatalf("OpDiv not found")
+}
@@ -0,0 +1,36 @@
+package compiler
+
+import (
+	"mlang/ast"
+	"mlang/object"
+)
+
+// scope функция, которая компилируется в данный момент. У основной программы outer == nil,
+// а ее переменные глобальные
+type scope struct {
+	instructions Instructions
+	sourceMap    []object.SourceMapEntry
+	outer        *scope
+	depth        int // число значений на стеке относительно начала кадра
+	loops        []*loop
+	tries        []*tryBlock
+}
+
+// loop незакрытые переходы break и continue цикла, который компилируется в данный момент
+type loop struct {
+	depth     int // глубина стека в начале итерации
+	breaks    []int
+	continues []int
+}
+
+// tryBlock блок try, внутри которого компилируются инструкции. Выход из него через return,
+// break или continue снимает его обработчики ошибок и выполняет finally
+type tryBlock struct {
+	handlers int // число установленных обработчиков: catch и finally внутри try, finally внутри catch
+	finally  *ast.BlockStatement
+	loops    int // число циклов функции, внутри которых находится блок
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer}
+}
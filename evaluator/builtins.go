@@ -1,9 +1,19 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
 	"mlang/object"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin{
@@ -13,94 +23,792 @@ var builtins = map[string]*object.Builtin{
 	"print": {
 		Fn: printFunc,
 	},
+	"forn": {
+		Fn: fornFunc,
+	},
 	"read": {
 		Fn: readFunc,
 	},
+	"readLine": {
+		Fn: readLineFunc,
+	},
+	"readAll": {
+		Fn: readAllFunc,
+	},
+	"readInt": {
+		Fn: readIntFunc,
+	},
+	"readWords": {
+		Fn: readWordsFunc,
+	},
+	"eof": {
+		Fn: eofFunc,
+	},
 	"bool": {
 		Fn: toBool,
 	},
+	"int": {
+		Fn: intFunc,
+	},
+	"float": {
+		Fn: floatFunc,
+	},
+	"round": {
+		Fn: roundingFunc("round", math.Round),
+	},
+	"floor": {
+		Fn: roundingFunc("floor", math.Floor),
+	},
+	"ceil": {
+		Fn: roundingFunc("ceil", math.Ceil),
+	},
 	"time": {
 		Fn: timeFunc,
 	},
+	"len": {
+		Fn: lenFunc,
+	},
+	"first": {
+		Fn: firstFunc,
+	},
+	"last": {
+		Fn: lastFunc,
+	},
+	"rest": {
+		Fn: restFunc,
+	},
+	"push": {
+		Fn: pushFunc,
+	},
+	"slice": {
+		Fn: sliceFunc,
+	},
+	"keys": {
+		Fn: keysFunc,
+	},
+	"values": {
+		Fn: valuesFunc,
+	},
+	"has": {
+		Fn: hasFunc,
+	},
+	"delete": {
+		Fn: deleteFunc,
+	},
+	"chan": {
+		Fn: chanFunc,
+	},
+	"send": {
+		Fn: sendFunc,
+	},
+	"recv": {
+		Fn: recvFunc,
+	},
+	"close": {
+		Fn: closeFunc,
+	},
+	"select": {
+		Fn: selectFunc,
+	},
 }
 
-func fornFunc(args ...object.Object) object.Object {
+func init() {
+	// await и awaitAll дожидаются задач, которые выполняют функции через applyFunction,
+	// поэтому не могут быть в инициализаторе builtins без цикла инициализации
+	builtins["await"] = &object.Builtin{Fn: awaitFunc}
+	builtins["awaitAll"] = &object.Builtin{Fn: awaitAllFunc}
+}
+
+// fornFunc вызывает функцию n раз, передавая номер итерации через переменную i окружения,
+// в котором функция создана
+func fornFunc(ctx *object.Context, args ...object.Object) object.Object {
 	if len(args) < 2 {
 		return newError("not enouth arguments")
 	}
-	switch obj := args[0].(type) {
-	case *object.Integer:
-	default:
-		return newError("forn expects integer as first argument. got=%s", obj.Type())
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("forn expects integer as first argument. got=%s", args[0].Type())
 	}
-	switch obj := args[1].(type) {
+	var env *object.Environment
+	switch fn := args[1].(type) {
 	case *object.Function:
+		env = fn.Env
+	case *object.Closure:
+		env = fn.Env
 	default:
-		return newError("forn expects function as second argument. got=%s", obj.Type())
+		return newError("forn expects function as second argument. got=%s", args[1].Type())
 	}
-	for i := int64(0); i < args[0].(*object.Integer).Value; i++ {
-		fun := args[1].(*object.Function)
-		fun.Env.Set("i", &object.Integer{Value: i})
-		applyFunction(fun, args[2:])
+
+	for i := int64(0); i < n.Value; i++ {
+		env.Assign("i", &object.Integer{Value: i})
+		// ошибки вызовов forn не возвращает, кроме превышения ограничений выполнения
+		if err, ok := ctx.Call(args[1], args[2:]).(*object.Error); ok && err.Err != nil {
+			return err
+		}
 	}
 	return NULL
 }
 
-func timeFunc(args ...object.Object) object.Object {
+func timeFunc(ctx *object.Context, args ...object.Object) object.Object {
 	return &object.Integer{Value: time.Now().UnixNano()}
 }
 
-func printFunc(args ...object.Object) object.Object {
+func printFunc(ctx *object.Context, args ...object.Object) object.Object {
 	for _, obj := range args {
-		fmt.Printf("%+v ", obj.Inspect())
+		if str, ok := obj.(*object.String); ok {
+			fmt.Fprintf(ctx.Out, "%s ", str.Value)
+			continue
+		}
+		fmt.Fprintf(ctx.Out, "%+v ", obj.Inspect())
 	}
-	fmt.Println()
+	fmt.Fprintln(ctx.Out)
 	return NULL
 }
 
-func sumFunc(args ...object.Object) object.Object {
-	var acc int64
+func sumFunc(ctx *object.Context, args ...object.Object) object.Object {
+	var acc object.Object = &object.Integer{Value: 0}
 	for _, obj := range args {
 		switch obj := obj.(type) {
-		case *object.Integer:
-			acc += obj.Value
+		case *object.Integer, *object.BigInt:
+			acc = evalInfixExpression("+", acc, obj)
 		case *object.Boolean:
 			if obj.Value {
-				acc++
+				acc = evalInfixExpression("+", acc, &object.Integer{Value: 1})
 			}
 		default:
 			return newError("sum expects integers or boolean. got=%s", obj.Type())
 		}
 	}
 
-	return &object.Integer{Value: acc}
+	return acc
 }
 
-func toBool(args ...object.Object) object.Object {
+func toBool(ctx *object.Context, args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return newError("bool expects only one argument, %d was given", len(args))
 	}
 
-	obj := args[0]
-	switch obj := obj.(type) {
-	case *object.Integer:
-		return nativeBoolToBooleanObject(obj.Value != 0)
+	return nativeBoolToBooleanObject(isTruthy(args[0]))
+}
+
+// intFunc преобразует число или строку в целое число, дробная часть отбрасывается
+func intFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("int expects only one argument, %d was given", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer, *object.BigInt:
+		return arg
+	case *object.Float:
+		return floatToInteger("int", math.Trunc(arg.Value))
+	case *object.String:
+		n, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+		if !ok {
+			return newError("int: invalid integer %q", arg.Value)
+		}
+		return object.IntegerFromBig(n)
 	default:
-		return nativeBoolToBooleanObject(!(obj == NULL || obj == FALSE))
+		return newError("int expects number or string. got=%s", arg.Type())
+	}
+}
+
+// floatFunc преобразует число или строку в число с плавающей точкой
+func floatFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("float expects only one argument, %d was given", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer, *object.BigInt:
+		return &object.Float{Value: toFloat(arg)}
+	case *object.Float:
+		return arg
+	case *object.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+		if err != nil {
+			return newError("float: invalid number %q", arg.Value)
+		}
+		return &object.Float{Value: f}
+	default:
+		return newError("float expects number or string. got=%s", arg.Type())
+	}
+}
+
+// roundingFunc создает встроенную функцию name, которая округляет число функцией round до целого
+func roundingFunc(name string, round func(float64) float64) object.BuiltinFunction {
+	return func(ctx *object.Context, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("%s expects only one argument, %d was given", name, len(args))
+		}
+
+		switch arg := args[0].(type) {
+		case *object.Integer, *object.BigInt:
+			return arg
+		case *object.Float:
+			return floatToInteger(name, round(arg.Value))
+		default:
+			return newError("%s expects number. got=%s", name, arg.Type())
+		}
 	}
 }
 
-func readFunc(args ...object.Object) object.Object {
+// floatToInteger преобразует целое значение float64 в integer или, если оно не помещается в int64, в BigInt
+func floatToInteger(name string, value float64) object.Object {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return newError("%s: %s is not a finite number", name, (&object.Float{Value: value}).Inspect())
+	}
+	if value < math.MinInt64 || value >= math.MaxInt64 {
+		n, _ := big.NewFloat(value).Int(nil)
+		return object.IntegerFromBig(n)
+	}
+	return &object.Integer{Value: int64(value)}
+}
+
+func readFunc(ctx *object.Context, args ...object.Object) object.Object {
 	if len(args) != 0 {
 		return newError("read expects no arguments")
 	}
 
 	var a int64
-	_, err := fmt.Scanf("%d", &a)
+	err := ctx.Read(interrupted(ctx), func(in *bufio.Reader) error {
+		_, err := fmt.Fscan(in, &a)
+		return err
+	})
 
+	if err == object.ErrInterrupted {
+		return interruptError(ctx)
+	}
 	if err != nil {
 		return NULL
 	}
 
 	return &object.Integer{Value: a}
 }
+
+// readLineFunc возвращает следующую строку ввода без перевода строки. Последняя строка
+// может не заканчиваться переводом строки, после нее возвращается ошибка конца ввода
+func readLineFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("readLine expects no arguments")
+	}
+
+	line, err := readInput(ctx, "readLine", readLine)
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: line}
+}
+
+// readAllFunc возвращает весь оставшийся ввод, в конце ввода - пустую строку
+func readAllFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("readAll expects no arguments")
+	}
+
+	data, err := readInput(ctx, "readAll", func(in *bufio.Reader) (string, error) {
+		data, err := ioutil.ReadAll(in)
+		return string(data), err
+	})
+	if err != nil {
+		return err
+	}
+	return &object.String{Value: data}
+}
+
+// readIntFunc пропускает пробельные символы и читает следующее слово ввода как целое число
+func readIntFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("readInt expects no arguments")
+	}
+
+	word, inputErr := readInput(ctx, "readInt", readWord)
+	if inputErr != nil {
+		return inputErr
+	}
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return &object.Integer{Value: n}
+	}
+	// число вне диапазона int64 читается как длинное целое, как в int
+	n, ok := new(big.Int).SetString(word, 10)
+	if !ok {
+		return object.NewError(object.INPUT_ERROR, "readInt: invalid integer %q", word)
+	}
+	return object.IntegerFromBig(n)
+}
+
+// readWordsFunc читает следующую строку ввода и возвращает массив ее слов
+func readWordsFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("readWords expects no arguments")
+	}
+
+	line, err := readInput(ctx, "readWords", readLine)
+	if err != nil {
+		return err
+	}
+	words := strings.Fields(line)
+	elements := make([]object.Object, len(words))
+	for i, word := range words {
+		elements[i] = &object.String{Value: word}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// eofFunc проверяет, что ввод закончился. Пробельные символы и пустые строки тоже считаются вводом
+func eofFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("eof expects no arguments")
+	}
+
+	err := ctx.Read(interrupted(ctx), func(in *bufio.Reader) error {
+		_, err := in.Peek(1)
+		return err
+	})
+	if err == object.ErrInterrupted {
+		return interruptError(ctx)
+	}
+	return nativeBoolToBooleanObject(err != nil)
+}
+
+func readLine(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+func readWord(in *bufio.Reader) (string, error) {
+	var word []rune
+	for {
+		r, _, err := in.ReadRune()
+		if err == io.EOF && len(word) != 0 {
+			return string(word), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if unicode.IsSpace(r) {
+			if len(word) != 0 {
+				return string(word), in.UnreadRune()
+			}
+			continue
+		}
+		word = append(word, r)
+	}
+}
+
+// readInput читает ввод функцией read и возвращает ошибку ввода встроенной функции name.
+// При отмене выполнения программы ожидание прерывается, а ввод остается для следующего чтения
+func readInput(ctx *object.Context, name string, read func(in *bufio.Reader) (string, error)) (string, *object.Error) {
+	var s string
+	err := ctx.Read(interrupted(ctx), func(in *bufio.Reader) (err error) {
+		s, err = read(in)
+		return err
+	})
+	switch {
+	case err == object.ErrInterrupted:
+		return "", interruptError(ctx)
+	case err != nil:
+		return "", inputError(name, err)
+	}
+	return s, nil
+}
+
+// inputError отличает конец ввода от остальных ошибок чтения
+func inputError(name string, err error) *object.Error {
+	if err == io.EOF {
+		return object.NewError(object.EOF_ERROR, "%s: end of input", name)
+	}
+	return object.NewError(object.INPUT_ERROR, "%s: %s", name, err)
+}
+
+func lenFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("len expects only one argument, %d was given", len(args))
+	}
+
+	switch obj := args[0].(type) {
+	case *object.String:
+		return &object.Integer{Value: int64(utf8.RuneCountInString(obj.Value))}
+	case *object.Array:
+		return &object.Integer{Value: int64(len(obj.Elements))}
+	case *object.Hash:
+		return &object.Integer{Value: int64(obj.Len())}
+	default:
+		return newError("len expects string, array or hash. got=%s", obj.Type())
+	}
+}
+
+func firstFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("first expects only one argument, %d was given", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first expects array. got=%s", args[0].Type())
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+	return arr.Elements[0]
+}
+
+func lastFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("last expects only one argument, %d was given", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("last expects array. got=%s", args[0].Type())
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+	return arr.Elements[len(arr.Elements)-1]
+}
+
+func restFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("rest expects only one argument, %d was given", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("rest expects array. got=%s", args[0].Type())
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+	elements := make([]object.Object, len(arr.Elements)-1)
+	copy(elements, arr.Elements[1:])
+	return &object.Array{Elements: elements}
+}
+
+func pushFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("push expects 2 arguments, %d was given", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("push expects array as first argument. got=%s", args[0].Type())
+	}
+
+	elements := make([]object.Object, len(arr.Elements), len(arr.Elements)+1)
+	copy(elements, arr.Elements)
+	return &object.Array{Elements: append(elements, args[1])}
+}
+
+func sliceFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("slice expects 2 or 3 arguments, %d was given", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("slice expects array as first argument. got=%s", args[0].Type())
+	}
+
+	bounds := []int64{0, int64(len(arr.Elements))}
+	for i, obj := range args[1:] {
+		bound, ok := obj.(*object.Integer)
+		if !ok {
+			return newError("slice expects integer bounds. got=%s", obj.Type())
+		}
+		bounds[i] = bound.Value
+	}
+
+	start, end := bounds[0], bounds[1]
+	if start < 0 {
+		return object.NewError(object.INDEX_ERROR, "negative index: %d", start)
+	}
+	if end < 0 {
+		return object.NewError(object.INDEX_ERROR, "negative index: %d", end)
+	}
+	if end > int64(len(arr.Elements)) {
+		return object.NewError(object.INDEX_ERROR, "index out of range: %d with length %d", end, len(arr.Elements))
+	}
+	if start > end {
+		return newError("invalid slice bounds: %d > %d", start, end)
+	}
+
+	elements := make([]object.Object, end-start)
+	copy(elements, arr.Elements[start:end])
+	return &object.Array{Elements: elements}
+}
+
+func keysFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("keys expects only one argument, %d was given", len(args))
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("keys expects hash. got=%s", args[0].Type())
+	}
+
+	elements := []object.Object{}
+	for _, pair := range hash.Pairs() {
+		elements = append(elements, pair.Key)
+	}
+	return &object.Array{Elements: elements}
+}
+
+func valuesFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("values expects only one argument, %d was given", len(args))
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("values expects hash. got=%s", args[0].Type())
+	}
+
+	elements := []object.Object{}
+	for _, pair := range hash.Pairs() {
+		elements = append(elements, pair.Value)
+	}
+	return &object.Array{Elements: elements}
+}
+
+func hasFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("has expects 2 arguments, %d was given", len(args))
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("has expects hash as first argument. got=%s", args[0].Type())
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return object.NewError(object.TYPE_ERROR, "unusable as hash key: %s", args[1].Type())
+	}
+
+	_, exist := hash.Get(key)
+	return nativeBoolToBooleanObject(exist)
+}
+
+func deleteFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("delete expects 2 arguments, %d was given", len(args))
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("delete expects hash as first argument. got=%s", args[0].Type())
+	}
+	key, ok := args[1].(object.Hashable)
+	if !ok {
+		return object.NewError(object.TYPE_ERROR, "unusable as hash key: %s", args[1].Type())
+	}
+
+	result := hash.Copy()
+	result.Delete(key)
+	return result
+}
+
+// interrupted возвращает канал, который закрывается при отмене выполнения программы,
+// или nil, если выполнение не отменяется
+func interrupted(ctx *object.Context) <-chan struct{} {
+	if ctx.Run == nil {
+		return nil
+	}
+	return ctx.Run.Done()
+}
+
+// interruptError ошибка прерванного ожидания, та же, что возвращает limiter при отмене контекста
+func interruptError(ctx *object.Context) *object.Error {
+	return limitError(ctx.Run.Err())
+}
+
+func awaitFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("await expects only one argument, %d was given", len(args))
+	}
+	task, ok := args[0].(*object.Task)
+	if !ok {
+		return newError("await expects task. got=%s", args[0].Type())
+	}
+
+	return awaitTask(ctx, task)
+}
+
+// awaitTask дожидается задачи или отмены выполнения программы. Ошибка задачи копируется,
+// так как ее могут одновременно ожидать несколько потоков, дополняя стек вызовов
+func awaitTask(ctx *object.Context, task *object.Task) object.Object {
+	select {
+	case <-task.Finished():
+	case <-interrupted(ctx):
+		return interruptError(ctx)
+	}
+	result := task.Await()
+	if err, ok := result.(*object.Error); ok {
+		return err.Copy()
+	}
+	return result
+}
+
+func awaitAllFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("awaitAll expects only one argument, %d was given", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("awaitAll expects array of tasks. got=%s", args[0].Type())
+	}
+	for _, el := range arr.Elements {
+		if _, ok := el.(*object.Task); !ok {
+			return newError("awaitAll expects array of tasks. got element %s", el.Type())
+		}
+	}
+
+	results := make([]object.Object, len(arr.Elements))
+	var err object.Object
+	for i, el := range arr.Elements {
+		results[i] = awaitTask(ctx, el.(*object.Task))
+		if err == nil && isError(results[i]) {
+			err = results[i]
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return &object.Array{Elements: results}
+}
+
+func chanFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newError("chan expects at most one argument, %d was given", len(args))
+	}
+
+	var capacity int64
+	if len(args) == 1 {
+		c, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("chan expects integer capacity. got=%s", args[0].Type())
+		}
+		capacity = c.Value
+	}
+	if capacity < 0 {
+		return newError("negative channel capacity: %d", capacity)
+	}
+	if capacity > object.MaxChannelCapacity {
+		return newError("channel capacity %d is too large, at most %d", capacity, object.MaxChannelCapacity)
+	}
+
+	return object.NewChannel(int(capacity))
+}
+
+func sendFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("send expects 2 arguments, %d was given", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newError("send expects channel as first argument. got=%s", args[0].Type())
+	}
+
+	switch ch.Send(args[1], interrupted(ctx)) {
+	case object.ErrInterrupted:
+		return interruptError(ctx)
+	case object.ErrClosedChannel:
+		return newError("send on closed channel")
+	}
+	return NULL
+}
+
+// recvFunc возвращает пару [значение, true] или [null, false], если канал закрыт
+func recvFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("recv expects only one argument, %d was given", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newError("recv expects channel. got=%s", args[0].Type())
+	}
+
+	value, ok, err := ch.Recv(interrupted(ctx))
+	if err != nil {
+		return interruptError(ctx)
+	}
+	return recvResult(value, ok)
+}
+
+func recvResult(value object.Object, ok bool) *object.Array {
+	if !ok {
+		return &object.Array{Elements: []object.Object{NULL, FALSE}}
+	}
+	return &object.Array{Elements: []object.Object{value, TRUE}}
+}
+
+func closeFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("close expects only one argument, %d was given", len(args))
+	}
+	ch, ok := args[0].(*object.Channel)
+	if !ok {
+		return newError("close expects channel. got=%s", args[0].Type())
+	}
+
+	if err := ch.Close(); err != nil {
+		return newError("close of closed channel")
+	}
+	return NULL
+}
+
+// selectFunc ждет значение из первого готового канала массива и возвращает
+// [индекс канала, значение, true] или [индекс канала, null, false] для закрытого канала.
+// Вторым аргументом можно передать таймаут в миллисекундах, по его истечении возвращается null
+func selectFunc(ctx *object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("select expects 1 or 2 arguments, %d was given", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("select expects array of channels. got=%s", args[0].Type())
+	}
+
+	cases := make([]reflect.SelectCase, 0, len(arr.Elements)+1)
+	for _, el := range arr.Elements {
+		ch, ok := el.(*object.Channel)
+		if !ok {
+			return newError("select expects array of channels. got element %s", el.Type())
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.Ch)})
+	}
+
+	if len(args) == 2 {
+		timeout, ok := args[1].(*object.Integer)
+		if !ok {
+			return newError("select expects integer timeout. got=%s", args[1].Type())
+		}
+		timer := time.NewTimer(time.Duration(timeout.Value) * time.Millisecond)
+		defer timer.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+	} else if len(cases) == 0 {
+		return newError("select without channels and timeout blocks forever")
+	}
+
+	if done := interrupted(ctx); done != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+	}
+
+	chosen, value, ok := reflect.Select(cases)
+	switch {
+	case chosen == len(arr.Elements) && len(args) == 2:
+		return NULL
+	case chosen >= len(arr.Elements):
+		return interruptError(ctx)
+	}
+
+	result := recvResult(nil, false)
+	if ok {
+		result = recvResult(value.Interface().(object.Object), true)
+	}
+	index := &object.Integer{Value: int64(chosen)}
+	return &object.Array{Elements: append([]object.Object{index}, result.Elements...)}
+}
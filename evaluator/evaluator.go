@@ -6,30 +6,62 @@ package evaluator
 */
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/big"
 	"mlang/ast"
 	"mlang/object"
 )
 
 const MAX_RECURSION_LEVEL = 90000
 
-var lvl int
+// thread состояние одного потока выполнения: основной программы или задачи, запущенной через fork.
+// Каждая задача получает собственный thread, поэтому уровень рекурсии и глубина вызовов считаются
+// независимо, а ограничения запуска (limiter) общие
+type thread struct {
+	lvl     int
+	calls   int
+	limiter *limiter
+	ctx     *object.Context // окружение встроенных функций, вызывающих функции в этом потоке
+}
+
+func newThread(l *limiter, ctx *object.Context) *thread {
+	t := &thread{limiter: l}
+	t.ctx = ctx.WithCall(t.applyFunction)
+	t.ctx.Run = l.ctx
+	return t
+}
+
+// fork создает поток для задачи с теми же ограничениями и потоками ввода-вывода
+func (t *thread) fork() *thread {
+	return newThread(t.limiter, t.ctx)
+}
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func EvalProgram(stmts []ast.Statement, env *object.Environment) []object.Object {
-	builtins["forn"] = &object.Builtin{Fn: fornFunc}
+	return newThread(unlimited(), stdContext).evalProgram(stmts, env)
+}
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return newThread(unlimited(), stdContext).eval(node, env)
+}
+
+func (t *thread) evalProgram(stmts []ast.Statement, env *object.Environment) []object.Object {
 	var (
 		results []object.Object
 		result  object.Object
 	)
 
 	for _, stmt := range stmts {
-		result = Eval(stmt, env)
+		result = t.eval(stmt, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -38,6 +70,11 @@ func EvalProgram(stmts []ast.Statement, env *object.Environment) []object.Object
 		case *object.Error:
 			results = append(results, result)
 			return results
+		case *object.Break, *object.Continue:
+			err := loopControlError(result)
+			err.Pos = stmt.Pos()
+			results = append(results, err)
+			return results
 		}
 		results = append(results, result)
 	}
@@ -45,65 +82,155 @@ func EvalProgram(stmts []ast.Statement, env *object.Environment) []object.Object
 	return results
 }
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
-	lvl += 1
-	defer func() { lvl -= 1 }()
-	if lvl > MAX_RECURSION_LEVEL {
-		return newError("max recursion level reached")
+func (t *thread) eval(node ast.Node, env *object.Environment) object.Object {
+	t.lvl += 1
+	defer func() { t.lvl -= 1 }()
+	if t.lvl > MAX_RECURSION_LEVEL {
+		return object.NewError(object.RECURSION_ERROR, "max recursion level reached")
+	}
+	if err := t.limiter.step(); err != nil {
+		return err
+	}
+
+	result := t.evalNode(node, env)
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		// позицию получает самый глубокий узел, на котором возникла ошибка
+		err.Pos = node.Pos()
 	}
+	return result
+}
+
+func (t *thread) evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.AssignStatement:
-		return evalAssignStatement(node, env)
+		return t.evalAssignStatement(node, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return t.eval(node.Expression, env)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return t.evalIdentifier(node, env)
 	case *ast.Null:
 		return NULL
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return t.limiter.allocate(&object.Function{Parameters: params, Locals: node.Locals, Env: env, Body: body})
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		function := t.eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
+		var args []object.Object
+		if id, ok := ast.LenArgument(node); ok {
+			args = []object.Object{t.peekIdentifier(id, env)}
+		} else {
+			args = t.evalExpressions(node.Arguments, env)
+		}
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		if fn, ok := function.(*object.Function); ok && node.Tail && len(fn.Parameters) == len(args) {
+			// вызов выполнит applyFunction, в которой выполняется текущая функция
+			return &object.TailCall{Fn: fn, Args: args}
+		}
+		result := t.applyFunction(function, args)
+		if err, ok := result.(*object.Error); ok {
+			addStackFrame(err, node, function, len(args))
+		}
+		return result
+	case *ast.ForkExpression:
+		return t.evalForkExpression(node, env)
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			return t.limiter.allocate(&object.BigInt{Value: node.Big})
+		}
+		return t.limiter.allocate(&object.Integer{Value: node.Value})
+	case *ast.FloatLiteral:
+		return t.limiter.allocate(&object.Float{Value: node.Value})
+	case *ast.StringLiteral:
+		return t.limiter.allocate(&object.String{Value: node.Value})
+	case *ast.ArrayLiteral:
+		elements := t.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return t.limiter.allocate(&object.Array{Elements: elements})
+	case *ast.HashLiteral:
+		return t.limiter.allocate(t.evalHashLiteral(node, env))
+	case *ast.IndexExpression:
+		var left object.Object
+		if id, ok := node.Left.(*ast.Identifier); ok && ast.Borrowed(id, []ast.Expression{node.Index}) {
+			left = t.peekIdentifier(id, env)
+		} else {
+			left = t.eval(node.Left, env)
+		}
+		if isError(left) {
+			return left
+		}
+		index := t.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := t.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return t.limiter.allocate(evalPrefixExpression(node.Operator, right))
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return t.evalLogicalExpression(node, env)
+		}
+		left := t.eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := t.eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return t.limiter.allocate(evalInfixExpression(node.Operator, left, right))
 	case *ast.BlockStatement:
-		return evalBlockStatements(node.Statements, env)
+		return t.evalBlockStatements(node.Statements, env)
+	case *ast.WhileStatement:
+		return t.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return t.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return t.evalIfExpression(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := t.eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := t.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return thrownError(val)
+	case *ast.TryExpression:
+		return t.evalTryExpression(node, env)
+	case *ast.ImportStatement:
+		module := importModule(t.limiter.context(), t.ctx, node.Path, node.Token.Pos.File)
+		if isError(module) {
+			return module
+		}
+		env.Set(node.Name.Depth, node.Name.Slot, module)
+		return module
+	case *ast.SelectorExpression:
+		left := t.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalSelectorExpression(left, node.Name)
 	}
 
 	return nil
@@ -124,37 +251,287 @@ func isTruthy(obj object.Object) bool {
 	switch obj := obj.(type) {
 	case *object.Integer:
 		return obj.Value != 0
+	case *object.BigInt:
+		return obj.Value.Sign() != 0
+	case *object.Float:
+		return obj.Value != 0
+	case *object.String:
+		return obj.Value != ""
 	default:
 		return !(obj == NULL || obj == FALSE)
 	}
 }
 
-func evalAssignStatement(as *ast.AssignStatement, env *object.Environment) object.Object {
-	val := Eval(as.Value, env)
+func (t *thread) evalAssignStatement(as *ast.AssignStatement, env *object.Environment) object.Object {
+	if as.Operator != "" {
+		return t.evalCompoundAssignment(as, env)
+	}
+
+	val := t.eval(as.Value, env)
 	if isError(val) {
 		return val
 	}
-	env.Set(as.Name.Value, val)
+	if err := t.assign(as.Target, val, env); err != nil {
+		return err
+	}
 	return val
 }
 
-func evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(id.Value); ok {
+// evalCompoundAssignment выполняет x op= value. Переменная читается до вычисления значения,
+// индексы элемента вычисляются после значения и только один раз
+func (t *thread) evalCompoundAssignment(as *ast.AssignStatement, env *object.Environment) object.Object {
+	if id, ok := as.Target.(*ast.Identifier); ok {
+		old := t.evalIdentifier(id, env)
+		if isError(old) {
+			return old
+		}
+		val := t.eval(as.Value, env)
+		if isError(val) {
+			return val
+		}
+		result := t.limiter.allocate(evalInfixExpression(as.Operator, old, val))
+		if !isError(result) {
+			env.Set(id.Depth, id.Slot, result)
+		}
+		return result
+	}
+
+	val := t.eval(as.Value, env)
+	if isError(val) {
 		return val
 	}
+	var result object.Object
+	updated := t.updateIndexTarget(as.Target.(*ast.IndexExpression), env, func(container object.Object, indices []object.Object, inPlace bool) object.Object {
+		var updated object.Object
+		if result, updated = updateIndex(container, indices, as.Operator, val, inPlace); inPlace {
+			return updated
+		}
+		return t.limiter.allocate(updated)
+	})
+	if isError(updated) {
+		return updated
+	}
+	return result
+}
+
+// assign присваивает значение цели: переменной, элементу массива или словаря либо образцу деструктуризации.
+// Возвращает ошибку или nil
+func (t *thread) assign(target ast.Expression, val object.Object, env *object.Environment) object.Object {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		env.Set(target.Depth, target.Slot, val)
+	case *ast.IndexExpression:
+		updated := t.updateIndexTarget(target, env, func(container object.Object, indices []object.Object, inPlace bool) object.Object {
+			if inPlace {
+				return setIndex(container, indices, val, true)
+			}
+			return t.limiter.allocate(setIndex(container, indices, val, false))
+		})
+		if isError(updated) {
+			return updated
+		}
+	case *ast.ArrayLiteral:
+		elements, err := unpackArray(val, len(target.Elements))
+		if err != nil {
+			return err
+		}
+		for i, element := range target.Elements {
+			if err := t.assign(element, elements[i], env); err != nil {
+				return err
+			}
+		}
+	case *ast.HashLiteral:
+		keys := t.evalExpressions(target.Keys, env)
+		if len(keys) == 1 && isError(keys[0]) {
+			return keys[0]
+		}
+		values, err := unpackHash(val, keys)
+		if err != nil {
+			return err
+		}
+		for i, value := range target.Values {
+			if err := t.assign(value, values[i], env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateIndexTarget вычисляет цель a[i][j] и присваивает переменной a результат update для ее значения
+// и индексов. Если значение нужно только для присваивания элементу (ast.Borrowed), update вызывается
+// под блокировкой окружения и может изменить значение на месте, когда оно принадлежит этому потоку.
+// Иначе значение переменной читается до вычисления индексов, а update создает копию
+func (t *thread) updateIndexTarget(target *ast.IndexExpression, env *object.Environment,
+	update func(container object.Object, indices []object.Object, inPlace bool) object.Object) object.Object {
+	root, path := ast.IndexPath(target)
+	if !ast.Borrowed(root, path) {
+		container := t.evalIdentifier(root, env)
+		if isError(container) {
+			return container
+		}
+		indices := t.evalExpressions(path, env)
+		if len(indices) == 1 && isError(indices[0]) {
+			return indices[0]
+		}
+		updated := update(container, indices, false)
+		if !isError(updated) {
+			env.Set(root.Depth, root.Slot, updated)
+		}
+		return updated
+	}
+
+	indices := t.evalExpressions(path, env)
+	if len(indices) == 1 && isError(indices[0]) {
+		return indices[0]
+	}
+	updated := env.Update(root.Depth, root.Slot, t, func(container object.Object, owned bool) object.Object {
+		if container == nil {
+			return nil
+		}
+		return update(container, indices, owned)
+	})
+	if updated == nil {
+		// переменной ничего не присвоено: ошибка или встроенная функция, элементам которой нельзя присваивать
+		container := t.evalIdentifier(root, env)
+		if isError(container) {
+			return container
+		}
+		return update(container, indices, false)
+	}
+	return updated
+}
+
+// setIndex возвращает копию container, в которой элемент по пути indices заменен на value.
+// Массивы и словари не изменяются: копируются все значения по пути, в словарь добавляется новый ключ.
+// Если inPlace, сам container изменяется на месте и возвращается он же, вложенные значения все равно копируются
+func setIndex(container object.Object, indices []object.Object, value object.Object, inPlace bool) object.Object {
+	index := indices[0]
+	if len(indices) > 1 {
+		element := evalIndexExpression(container, index)
+		if isError(element) {
+			return element
+		}
+		if value = setIndex(element, indices[1:], value, false); isError(value) {
+			return value
+		}
+	}
+
+	switch container := container.(type) {
+	case *object.Array:
+		if idx, ok := index.(*object.Integer); ok {
+			if err := checkArrayIndex(idx.Value, len(container.Elements)); err != nil {
+				return err
+			}
+			if inPlace {
+				container.Elements[idx.Value] = value
+				return container
+			}
+			elements := make([]object.Object, len(container.Elements))
+			copy(elements, container.Elements)
+			elements[idx.Value] = value
+			return &object.Array{Elements: elements}
+		}
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return object.NewError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+		}
+		if inPlace {
+			container.Set(key, value)
+			return container
+		}
+		hash := container.Copy()
+		hash.Set(key, value)
+		return hash
+	}
+	return object.NewError(object.TYPE_ERROR, "index assignment not supported: %s[%s]", container.Type(), index.Type())
+}
+
+// updateIndex выполняет container[indices] op= value и возвращает новое значение элемента и копию container
+// (или сам container, измененный на месте, если inPlace)
+func updateIndex(container object.Object, indices []object.Object, operator string, value object.Object, inPlace bool) (object.Object, object.Object) {
+	old := container
+	for _, index := range indices {
+		if old = evalIndexExpression(old, index); isError(old) {
+			return old, old
+		}
+	}
+	result := evalInfixExpression(operator, old, value)
+	if isError(result) {
+		return result, result
+	}
+	return result, setIndex(container, indices, result, inPlace)
+}
+
+// unpackArray возвращает элементы массива для образца [a, b, ...] из n целей
+func unpackArray(value object.Object, n int) ([]object.Object, *object.Error) {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return nil, object.NewError(object.TYPE_ERROR, "cannot destructure %s as array", value.Type())
+	}
+	if len(array.Elements) != n {
+		return nil, object.NewError(object.INDEX_ERROR, "cannot destructure array of length %d into %d targets",
+			len(array.Elements), n)
+	}
+	return array.Elements, nil
+}
+
+// unpackHash возвращает значения словаря по ключам образца {key: target, ...}, отсутствующим ключам соответствует null
+func unpackHash(value object.Object, keys []object.Object) ([]object.Object, *object.Error) {
+	if _, ok := value.(*object.Hash); !ok {
+		return nil, object.NewError(object.TYPE_ERROR, "cannot destructure %s as hash", value.Type())
+	}
+	values := make([]object.Object, len(keys))
+	for i, key := range keys {
+		values[i] = evalHashIndexExpression(value, key)
+		if err, ok := values[i].(*object.Error); ok {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// evalIdentifier берет значение переменной из ячейки, найденной при разрешении имен.
+// Пока локальной переменной ничего не присвоено, читается внешняя переменная с тем же именем,
+// а для глобальной переменной без значения ищется встроенная функция с тем же именем
+func (t *thread) evalIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
+	if id.Scope != ast.BUILTIN {
+		if val := env.Get(id.Depth, id.Slot); val != nil {
+			return val
+		}
+		if id.Shadowed != nil {
+			return t.evalIdentifier(id.Shadowed, env)
+		}
+	}
 
 	if builtin, ok := builtins[id.Value]; ok {
 		return builtin
 	}
 
-	return newError("identifier not found: %s", id.Value)
+	return object.NewError(object.NAME_ERROR, "identifier not found: %s", id.Value)
+}
+
+// peekIdentifier читает переменную, как evalIdentifier, но без передачи владения ее значением (ast.Borrowed)
+func (t *thread) peekIdentifier(id *ast.Identifier, env *object.Environment) object.Object {
+	if err := t.limiter.step(); err != nil {
+		return err
+	}
+	if val := env.Peek(id.Depth, id.Slot, t); val != nil {
+		return val
+	}
+	val := t.evalIdentifier(id, env)
+	if err, ok := val.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = id.Pos()
+	}
+	return val
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (t *thread) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := t.eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -165,31 +542,123 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func evalIndexExpression(left object.Object, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return object.NewError(object.TYPE_ERROR, "index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// importModule загружает модуль для инструкции import в файле from, модуль выполняется с контекстом ctx
+func importModule(ctx context.Context, env *object.Context, path string, from string) object.Object {
+	if env.Import == nil {
+		return object.NewError(object.IMPORT_ERROR, "import is not available: %q", path)
+	}
+	return env.Import(ctx, path, from)
+}
+
+// evalSelectorExpression возвращает глобальную переменную модуля
+func evalSelectorExpression(left object.Object, name string) object.Object {
+	module, ok := left.(*object.Module)
+	if !ok {
+		return object.NewError(object.TYPE_ERROR, "selector not supported: %s.%s", left.Type(), name)
+	}
+	if value, ok := module.Member(name); ok {
+		return value
+	}
+	return object.NewError(object.NAME_ERROR, "module %s has no member %s", module.Name, name)
+}
+
+func evalArrayIndexExpression(array object.Object, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+	idx := index.(*object.Integer).Value
+
+	if err := checkArrayIndex(idx, len(elements)); err != nil {
+		return err
+	}
+
+	return elements[idx]
+}
+
+func checkArrayIndex(idx int64, length int) *object.Error {
+	if idx < 0 {
+		return object.NewError(object.INDEX_ERROR, "negative index: %d", idx)
+	}
+	if idx >= int64(length) {
+		return object.NewError(object.INDEX_ERROR, "index out of range: %d with length %d", idx, length)
+	}
+	return nil
+}
+
+func evalHashIndexExpression(hash object.Object, index object.Object) object.Object {
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return object.NewError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hash.(*object.Hash).Get(key)
+	if !ok {
+		return NULL
+	}
+
+	return value
+}
+
+func (t *thread) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+
+	for i, keyNode := range node.Keys {
+		key := t.eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return object.NewError(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
+		}
+
+		value := t.eval(node.Values[i], env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
+
+func (t *thread) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := t.eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return t.eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return t.eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
-func evalBlockStatements(stmts []ast.Statement, env *object.Environment) object.Object {
+func (t *thread) evalBlockStatements(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 	result = NULL
 
 	for _, stmt := range stmts {
-		result = Eval(stmt, env)
+		result = t.eval(stmt, env)
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -198,14 +667,178 @@ func evalBlockStatements(stmts []ast.Statement, env *object.Environment) object.
 	return result
 }
 
+func (t *thread) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := t.eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := t.eval(ws.Body, env)
+		if result == BREAK {
+			return NULL
+		}
+		if result != nil && (isError(result) || result.Type() == object.RETURN_VALUE_OBJ) {
+			return result
+		}
+	}
+}
+
+func (t *thread) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	if fs.Init != nil {
+		init := t.eval(fs.Init, env)
+		if isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := t.eval(fs.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		result := t.eval(fs.Body, env)
+		if result == BREAK {
+			return NULL
+		}
+		if result != nil && (isError(result) || result.Type() == object.RETURN_VALUE_OBJ) {
+			return result
+		}
+
+		if fs.Step != nil {
+			step := t.eval(fs.Step, env)
+			if isError(step) {
+				return step
+			}
+		}
+	}
+}
+
+// evalTryExpression выполняет блок try, ошибку из него ловит блок catch. Блок finally выполняется
+// при любом завершении try и catch: обычном, с ошибкой, через return, break или continue,
+// а если он сам завершается досрочно, это заменяет результат try.
+// Ошибки превышения ограничений и слишком глубокой рекурсии не ловятся, и finally для них не выполняется
+func (t *thread) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := t.eval(te.Block, env)
+	if err, ok := result.(*object.Error); ok && te.Catch != nil && catchable(err) {
+		env.Set(te.Param.Depth, te.Param.Slot, caughtError(err))
+		result = t.eval(te.Catch, env)
+	}
+
+	if te.Finally == nil {
+		return result
+	}
+	if err, ok := result.(*object.Error); ok && !catchable(err) {
+		return result
+	}
+	switch final := t.eval(te.Finally, env); final.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return final
+	}
+	return result
+}
+
+// catchable сообщает, можно ли поймать ошибку. Ошибка рекурсии не ловится, как и превышение ограничений:
+// у вычислителя и виртуальной машины разная предельная глубина, и иначе одна программа
+// ловила бы ее только одним из способов выполнения
+func catchable(err *object.Error) bool {
+	return err.Kind != object.LIMIT_ERROR && err.Kind != object.RECURSION_ERROR
+}
+
+// caughtError превращает пойманную ошибку в словарь, который получает переменная catch
+func caughtError(err *object.Error) *object.Hash {
+	kind := err.Kind
+	if kind == "" {
+		kind = object.RUNTIME_ERROR
+	}
+	var pos, value object.Object = NULL, NULL
+	if err.Pos.IsValid() {
+		pos = &object.String{Value: err.Pos.String()}
+	}
+	if err.Value != nil {
+		value = err.Value
+	}
+
+	hash := object.NewHash()
+	hash.Set(&object.String{Value: "message"}, &object.String{Value: err.Message})
+	hash.Set(&object.String{Value: "kind"}, &object.String{Value: kind})
+	hash.Set(&object.String{Value: "position"}, pos)
+	hash.Set(&object.String{Value: "value"}, value)
+	return hash
+}
+
+// thrownError создает ошибку из значения throw. Строка становится сообщением, а словарь с ключом
+// "message" описывает ошибку полями message, kind и value, как словарь пойманной ошибки,
+// поэтому пойманную ошибку можно бросить дальше. Остальные значения доступны в catch через value
+func thrownError(value object.Object) *object.Error {
+	err := &object.Error{Message: value.Inspect(), Kind: object.THROWN_ERROR, Value: value}
+	switch value := value.(type) {
+	case *object.String:
+		err.Message = value.Value
+	case *object.Hash:
+		message, ok := value.Get(&object.String{Value: "message"})
+		if !ok {
+			break
+		}
+		if message, ok := message.(*object.String); ok {
+			err.Message = message.Value
+		} else {
+			err.Message = message.Inspect()
+		}
+		if kind, ok := value.Get(&object.String{Value: "kind"}); ok {
+			if kind, ok := kind.(*object.String); ok {
+				err.Kind = kind.Value
+			}
+		}
+		if inner, ok := value.Get(&object.String{Value: "value"}); ok {
+			err.Value = inner
+		}
+	}
+	return err
+}
+
+// loopControlError превращает break или continue, вышедшие за пределы цикла, в ошибку
+func loopControlError(obj object.Object) *object.Error {
+	return newError("%s outside loop", obj.Inspect())
+}
+
+// evalLogicalExpression вычисляет && и || с сокращенным вычислением: правый операнд вычисляется,
+// только если левый не определил результат. Результат - логическое значение истинности операндов
+func (t *thread) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := t.eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if isTruthy(left) == (node.Operator == "||") {
+		// true || x и false && x не зависят от x
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+	right := t.eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalTildePrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -213,33 +846,52 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	switch right.Type() {
 	case object.INTEGER_OBJ:
 		value := right.(*object.Integer).Value
+		if value == math.MinInt64 {
+			return object.IntegerFromBig(new(big.Int).Neg(big.NewInt(value)))
+		}
 		return &object.Integer{Value: -value}
+	case object.BIGINT_OBJ:
+		value := right.(*object.BigInt).Value
+		return object.IntegerFromBig(new(big.Int).Neg(value))
+	case object.FLOAT_OBJ:
+		value := right.(*object.Float).Value
+		return &object.Float{Value: -value}
 	default:
-		return newError("unknown operator: -%s", right.Type())
+		return object.NewError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
 }
 
-func evalBangOperatorExpression(right object.Object) object.Object {
-	return nativeBoolToBooleanObject(!isTruthy(right))
-}
-
-func isLogicOperator(operator string) bool {
-	switch operator {
-	case "||":
-		fallthrough
-	case "&&":
-		fallthrough
-	case "^":
-		return true
+// evalTildePrefixOperatorExpression побитовое отрицание целого числа, ~x == -x - 1
+func evalTildePrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return object.IntegerFromBig(new(big.Int).Not(right.Value))
 	default:
-		return false
+		return object.NewError(object.TYPE_ERROR, "unknown operator: ~%s", right.Type())
 	}
 }
 
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
+}
+
 func evalInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	switch {
+	case operator == "^":
+		// логическое исключающее или сравнивает истинность операндов любого типа, как || и &&
+		l, r := nativeBoolToBooleanObject(isTruthy(left)), nativeBoolToBooleanObject(isTruthy(right))
+		return evalBooleanInfixExpression(operator, l, r)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// одно из чисел дробное, поэтому целое приводится к float
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
 		return evalBooleanInfixExpression(operator, left, right)
 	case left.Type() == object.NULL_OBJ && right.Type() == object.NULL_OBJ:
@@ -248,13 +900,10 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
 		return nativeBoolToBooleanObject(left != right)
-	case isLogicOperator(operator):
-		l, r := nativeBoolToBooleanObject(isTruthy(left)), nativeBoolToBooleanObject(isTruthy(right))
-		return evalBooleanInfixExpression(operator, l, r)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+		return object.NewError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -265,7 +914,7 @@ func evalNullInfixExpression(operator string, left object.Object, right object.O
 	case "!=":
 		return nativeBoolToBooleanObject(left != right)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -275,33 +924,270 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return addIntegers(leftVal, rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return mulIntegers(leftVal, rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "/":
+		return subIntegers(leftVal, rightVal)
+	case "/", "~/", "%":
 		if rightVal == 0 {
-			return newError("division by zero %s %s %s", left.Inspect(), operator, right.Inspect())
+			return object.NewError(object.DIVISION_ERROR, "division by zero %s %s %s", left.Inspect(), operator, right.Inspect())
+		}
+		if operator == "%" {
+			return &object.Integer{Value: leftVal % rightVal}
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntInfixExpression(operator, left, right)
 		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "**", "<<":
+		return evalBigIntInfixExpression(operator, left, right)
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count %s", right.Inspect())
+		}
+		return &object.Integer{Value: leftVal >> uint64(rightVal)}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "~":
+		return &object.Integer{Value: leftVal ^ rightVal}
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
-	case "||":
-		return nativeBoolToBooleanObject(isTruthy(left) || isTruthy(right))
-	case "&&":
-		return nativeBoolToBooleanObject(isTruthy(left) && isTruthy(right))
-	case "^":
-		leftBool, rightBool := isTruthy(left), isTruthy(right)
-		return nativeBoolToBooleanObject(leftBool != rightBool)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// addIntegers, subIntegers и mulIntegers выполняют операции над int64, а при переполнении
+// повторяют их над big.Int и возвращают BigInt
+func addIntegers(a, b int64) object.Object {
+	sum := a + b
+	if (sum > a) != (b > 0) {
+		return object.IntegerFromBig(new(big.Int).Add(big.NewInt(a), big.NewInt(b)))
+	}
+	return &object.Integer{Value: sum}
+}
+
+func subIntegers(a, b int64) object.Object {
+	diff := a - b
+	if (diff < a) != (b > 0) {
+		return object.IntegerFromBig(new(big.Int).Sub(big.NewInt(a), big.NewInt(b)))
+	}
+	return &object.Integer{Value: diff}
+}
+
+func mulIntegers(a, b int64) object.Object {
+	if a == 0 || b == 0 {
+		return &object.Integer{Value: 0}
+	}
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return object.IntegerFromBig(new(big.Int).Mul(big.NewInt(a), big.NewInt(b)))
+	}
+	return &object.Integer{Value: product}
+}
+
+// evalBigIntInfixExpression выполняет операцию над целыми числами, одно из которых не помещается в int64
+func evalBigIntInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return object.IntegerFromBig(new(big.Int).Add(leftVal, rightVal))
+	case "*":
+		return object.IntegerFromBig(new(big.Int).Mul(leftVal, rightVal))
+	case "-":
+		return object.IntegerFromBig(new(big.Int).Sub(leftVal, rightVal))
+	case "/", "~/", "%":
+		if rightVal.Sign() == 0 {
+			return object.NewError(object.DIVISION_ERROR, "division by zero %s %s %s", left.Inspect(), operator, right.Inspect())
+		}
+		// Quo и Rem, как и операции над int64, округляют частное к нулю
+		if operator == "%" {
+			return object.IntegerFromBig(new(big.Int).Rem(leftVal, rightVal))
+		}
+		return object.IntegerFromBig(new(big.Int).Quo(leftVal, rightVal))
+	case "**":
+		return powIntegers(leftVal, rightVal)
+	case "<<", ">>":
+		return shiftInteger(operator, leftVal, rightVal)
+	case "&":
+		return object.IntegerFromBig(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return object.IntegerFromBig(new(big.Int).Or(leftVal, rightVal))
+	case "~":
+		return object.IntegerFromBig(new(big.Int).Xor(leftVal, rightVal))
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// maxIntegerBits наибольшая длина в битах результата ** и <<, больше которой число не вычисляется,
+// чтобы опечатка вроде 10 ** 10 ** 10 не исчерпала память
+const maxIntegerBits = 1 << 24
+
+// powIntegers возводит целое число в степень. Отрицательная степень дает float, как 2 ** -1 == 0.5
+func powIntegers(base *big.Int, exp *big.Int) object.Object {
+	if exp.Sign() < 0 {
+		b, _ := new(big.Float).SetInt(base).Float64()
+		e, _ := new(big.Float).SetInt(exp).Float64()
+		return &object.Float{Value: math.Pow(b, e)}
+	}
+	// степени 0, 1 и -1 не растут, для остальных длина результата - примерно длина основания, умноженная на степень
+	if abs := new(big.Int).Abs(base); abs.Cmp(big.NewInt(1)) > 0 {
+		if !exp.IsInt64() || exp.Int64() > maxIntegerBits/int64(abs.BitLen()-1) {
+			return newError("integer too large: %s ** %s", base, exp)
+		}
+	}
+	return object.IntegerFromBig(new(big.Int).Exp(base, exp, nil))
+}
+
+// shiftInteger сдвигает целое число на count бит. Сдвиг вправо округляет вниз, как деление на степень двойки
+func shiftInteger(operator string, value *big.Int, count *big.Int) object.Object {
+	if count.Sign() < 0 {
+		return newError("negative shift count %s", count)
+	}
+	if operator == ">>" {
+		if !count.IsInt64() || count.Int64() > int64(value.BitLen()) {
+			// все значащие биты сдвинуты, остается 0 или -1 для отрицательных чисел
+			count = big.NewInt(int64(value.BitLen()) + 1)
+		}
+		return object.IntegerFromBig(new(big.Int).Rsh(value, uint(count.Int64())))
+	}
+	if value.Sign() == 0 {
+		return &object.Integer{Value: 0}
+	}
+	if !count.IsInt64() || count.Int64() > maxIntegerBits-int64(value.BitLen()) {
+		return newError("integer too large: %s << %s", value, count)
+	}
+	return object.IntegerFromBig(new(big.Int).Lsh(value, uint(count.Int64())))
+}
+
+func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "/":
+		if rightVal == 0 {
+			return object.NewError(object.DIVISION_ERROR, "division by zero %s %s %s", left.Inspect(), operator, right.Inspect())
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "~/":
+		if rightVal == 0 {
+			return object.NewError(object.DIVISION_ERROR, "division by zero %s %s %s", left.Inspect(), operator, right.Inspect())
+		}
+		return floatToInteger(operator, math.Trunc(leftVal/rightVal))
+	case "%":
+		if rightVal == 0 {
+			return object.NewError(object.DIVISION_ERROR, "division by zero %s %s %s", left.Inspect(), operator, right.Inspect())
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isInteger(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.BigInt:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	_, ok := obj.(*object.Float)
+	return ok || isInteger(obj)
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInt).Value
+}
+
+// toFloat возвращает значение числа как float64
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	default:
+		return obj.(*object.Float).Value
+	}
+}
+
+func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	default:
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -311,18 +1197,22 @@ func evalBooleanInfixExpression(operator string, left object.Object, right objec
 		return nativeBoolToBooleanObject(left == right)
 	case "!=":
 		return nativeBoolToBooleanObject(left != right)
-	case "&&":
+	case "&":
 		return nativeBoolToBooleanObject(left == TRUE && right == TRUE)
-	case "||":
+	case "|":
 		return nativeBoolToBooleanObject(left == TRUE || right == TRUE)
-	case "^":
+	case "^", "~":
 		return nativeBoolToBooleanObject(left != right)
 	case "<":
 		return nativeBoolToBooleanObject(left == FALSE && right == TRUE)
 	case ">":
 		return nativeBoolToBooleanObject(left == TRUE && right == FALSE)
+	case "<=":
+		return nativeBoolToBooleanObject(left == FALSE || right == TRUE)
+	case ">=":
+		return nativeBoolToBooleanObject(left == TRUE || right == FALSE)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return object.NewError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -333,28 +1223,101 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (t *thread) applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
 		if len(fn.Parameters) != len(args) {
-			return newError("function expects %d arguments, %d was given",
+			return object.NewError(object.ARGUMENT_ERROR, "function expects %d arguments, %d was given",
 				len(fn.Parameters), len(args))
 		}
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		return t.callFunction(fn, args)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		return t.limiter.allocate(fn.Fn(t.ctx, args...))
 	default:
-		return newError("not a function: %s", fn.Type())
+		return object.NewError(object.TYPE_ERROR, "not a function: %s", fn.Type())
 	}
 }
 
+// callFunction выполняет пользовательскую функцию. Вызовы в хвостовой позиции возвращаются из тела
+// функции как TailCall и выполняются здесь же в цикле, поэтому хвостовая рекурсия не растет в глубину
+func (t *thread) callFunction(fn *object.Function, args []object.Object) object.Object {
+	t.calls++
+	defer func() { t.calls-- }()
+	if max := t.limiter.limits.MaxDepth; max > 0 && t.calls > max {
+		return limitError(ErrDepthLimit)
+	}
+
+	for {
+		extendedEnv := extendFunctionEnv(fn, args)
+		evaluated := t.eval(fn.Body, extendedEnv)
+		if evaluated == BREAK || evaluated == CONTINUE {
+			return loopControlError(evaluated)
+		}
+
+		evaluated = unwrapReturnValue(evaluated)
+		tailCall, ok := evaluated.(*object.TailCall)
+		if !ok {
+			return evaluated
+		}
+		fn, args = tailCall.Fn, tailCall.Args
+	}
+}
+
+// addStackFrame добавляет в стек ошибки вызов пользовательской функции, внутри которой она возникла.
+// Ошибки самого вызова (например, неверное число аргументов) еще не имеют позиции и в стек не попадают
+func addStackFrame(err *object.Error, call *ast.CallExpression, function object.Object, args int) {
+	if _, ok := function.(*object.Function); !ok || !err.Pos.IsValid() {
+		return
+	}
+
+	name := "<anonymous>"
+	switch callee := call.Function.(type) {
+	case *ast.Identifier:
+		name = callee.Value
+	case *ast.IndexExpression, *ast.SelectorExpression:
+		name = callee.String()
+	}
+
+	err.Stack = append(err.Stack, object.StackFrame{Function: name, Pos: call.Pos(), Args: args})
+}
+
+// evalForkExpression вычисляет функцию и аргументы в текущем потоке,
+// а сам вызов запускает в отдельной горутине со своим thread
+func (t *thread) evalForkExpression(fe *ast.ForkExpression, env *object.Environment) object.Object {
+	function := t.eval(fe.Call.Function, env)
+	if isError(function) {
+		return function
+	}
+	switch function.(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return object.NewError(object.TYPE_ERROR, "not a function: %s", function.Type())
+	}
+	args := t.evalExpressions(fe.Call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	task := object.NewTask()
+	go func() {
+		var result object.Object
+		defer func() {
+			if x := recover(); x != nil {
+				result = newError("task panicked: %v", x)
+			}
+			task.Resolve(result)
+		}()
+		result = t.fork().applyFunction(function, args)
+	}()
+
+	return task
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env := object.NewEnclosedEnvironment(fn.Env, fn.Locals)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		env.Set(0, param.Slot, args[paramIdx])
 	}
 
 	return env
@@ -1,11 +1,23 @@
-package evaluator
+package evaluator_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
 	"mlang/ast"
+	"mlang/compiler"
+	"mlang/evaluator"
 	"mlang/lexer"
 	"mlang/object"
 	"mlang/parser"
+	"mlang/resolver"
+	"mlang/vm"
+	"strings"
 	"testing"
+	"time"
 )
 
 func checkParserErrors(t *testing.T, p *parser.Parser) {
@@ -22,9 +34,73 @@ func checkParserErrors(t *testing.T, p *parser.Parser) {
 	t.FailNow()
 }
 
-func eval(stmts []ast.Statement) []object.Object {
+// eval выполняет программу вычислителем и виртуальной машиной, проверяет, что результаты совпадают,
+// и возвращает результаты вычислителя
+func eval(t *testing.T, stmts []ast.Statement) []object.Object {
+	t.Helper()
+	evaluated, _ := evalIO(t, stmts, "")
+	return evaluated
+}
+
+// evalIO выполняет программу обоими способами с вводом input, проверяет, что совпадают
+// результаты и вывод, и возвращает результаты и вывод вычислителя
+func evalIO(t *testing.T, stmts []ast.Statement, input string) ([]object.Object, string) {
+	t.Helper()
+	program := &ast.Program{Statements: stmts}
+
+	var evalOut, vmOut bytes.Buffer
+	interpreter := evaluator.NewInterpreter(resolve(t, program), evaluator.Limits{})
+	interpreter.Context = object.NewContext(strings.NewReader(input), &evalOut, ioutil.Discard)
+	evaluated := interpreter.Run(context.Background(), program)
+
+	globals := resolve(t, program)
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	ctx := object.NewContext(strings.NewReader(input), &vmOut, ioutil.Discard)
+	executed := vm.New(c.Bytecode(), globals, ctx).Run()
+
+	if evalOut.String() != vmOut.String() {
+		t.Fatalf("vm output should be %q, got %q", evalOut.String(), vmOut.String())
+	}
+	if len(executed) != len(evaluated) {
+		t.Fatalf("vm should return %d objects, got %d", len(evaluated), len(executed))
+	}
+	for i := range evaluated {
+		if !sameResult(evaluated[i], executed[i]) {
+			t.Fatalf("vm result[%d] should be %q, got %q", i, evaluated[i].Inspect(), executed[i].Inspect())
+		}
+	}
+
+	return evaluated, evalOut.String()
+}
+
+// resolve разрешает имена программы в новом окружении глобальных переменных
+func resolve(t *testing.T, program *ast.Program) *object.Environment {
+	t.Helper()
 	env := object.NewEnvironment()
-	return EvalProgram(stmts, env)
+	if errors := resolver.Resolve(program, env); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+	return env
+}
+
+// sameResult сравнивает результаты вычислителя и виртуальной машины. У ошибки переполнения стека
+// позиция и стек вызовов зависят от способа выполнения, поэтому сравнивается только сообщение
+func sameResult(evaluated object.Object, executed object.Object) bool {
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		return evaluated.Inspect() == executed.Inspect()
+	}
+	vmErr, ok := executed.(*object.Error)
+	if !ok {
+		return false
+	}
+	if err.Message == "max recursion level reached" {
+		return err.Message == vmErr.Message
+	}
+	return err.Inspect() == vmErr.Inspect() && err.StackTrace() == vmErr.StackTrace()
 }
 
 func TestEvalExpression(t *testing.T) {
@@ -35,7 +111,7 @@ func TestEvalExpression(t *testing.T) {
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	evaluated := eval(program.Statements)
+	evaluated := eval(t, program.Statements)
 
 	if len(evaluated) != 1 {
 		t.Fatalf("evaluated not has %d objects, got %d", 1, len(evaluated))
@@ -65,7 +141,7 @@ func TestIfExpression(t *testing.T) {
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	evaluated := eval(program.Statements)
+	evaluated := eval(t, program.Statements)
 
 	if len(evaluated) != 1 {
 		t.Fatalf("evaluated not has %d objects, got %d", 1, len(evaluated))
@@ -92,7 +168,7 @@ func TestFuncExpression(t *testing.T) {
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	evaluated := eval(program.Statements)
+	evaluated := eval(t, program.Statements)
 
 	if len(evaluated) != 2 {
 		t.Fatalf("evaluated not has %d objects, got %d", 2, len(evaluated))
@@ -113,6 +189,197 @@ func TestFuncExpression(t *testing.T) {
 	}
 }
 
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  string
+	}{
+		{"3 <= 3", "true"},
+		{"4 <= 3", "false"},
+		{"3 >= 4", "false"},
+		{"100000000000000000000 >= 100000000000000000000", "true"},
+		{"1.5 <= 2", "true"},
+		{`"abc" >= "abd"`, "false"},
+		{"false <= true", "true"},
+		{"7 % 3", "1"},
+		{"-7 % 3", "-1"},
+		{"7.5 % 2", "1.5"},
+		{"100000000000000000001 % 10", "1"},
+		{"7 ~/ 2", "3"},
+		{"-7 ~/ 2", "-3"},
+		{"7.5 ~/ 2", "3"},
+		{"1e20 ~/ 1", "100000000000000000000"},
+		{"2 ** 10", "1024"},
+		{"2 ** 64", "18446744073709551616"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"(-2) ** 3", "-8"},
+		{"2 ** -1", "0.5"},
+		{"2.0 ** 0.5", "1.4142135623730951"},
+		{"0 ** 0", "1"},
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ~ 3", "5"},
+		{"-1 ~ 100000000000000000000", "-100000000000000000001"},
+		{"true ~ true", "false"},
+		{"6 ^ 3", "false"},
+		{"1 ^ 0", "true"},
+		{"1 == 2 ^ 3", "true"},
+		{"-1 & 255", "255"},
+		{"true & false", "false"},
+		{"false | true", "true"},
+		{"~0", "-1"},
+		{"~100000000000000000000", "-100000000000000000001"},
+		{"1 << 4", "16"},
+		{"1 << 63", "9223372036854775808"},
+		{"-1 << 64", "-18446744073709551616"},
+		{"256 >> 4", "16"},
+		{"-16 >> 2", "-4"},
+		{"-1 >> 100", "-1"},
+		{"1 >> 100", "0"},
+		{"(1 << 100) >> 99", "2"},
+		{"-(1 << 100) >> 1000", "-1"},
+		{"x = 12; x & 1 == 0", "true"},
+		{"1 + 2 * 3 ** 2 % 5", "4"},
+		{"1 << 2 + 1", "8"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		if last := evaluated[len(evaluated)-1]; last.Inspect() != tt.res {
+			t.Errorf("tests[%d] %s should be %s, got %s", i, tt.expr, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	tests := []struct {
+		expr   string
+		res    string
+		output string
+	}{
+		{"x = 0; x != 0 && 10 / x > 1", "false", ""},
+		{"x = 0; x == 0 || 10 / x > 1", "true", ""},
+		{"x = 5; x != 0 && 10 / x > 1", "true", ""},
+		{`f = func(v) { print(v); v }; f(false) && f(true)`, "false", "false \n"},
+		{`f = func(v) { print(v); v }; f(true) || f(false)`, "true", "true \n"},
+		{`f = func(v) { print(v); v }; f(true) && f(0)`, "false", "true \n0 \n"},
+		{`f = func(v) { print(v); v }; f(0) || f("a")`, "true", "0 \na \n"},
+		{`fail = func() { throw "called" }; null && fail()`, "false", ""},
+		{`fail = func() { throw "called" }; 1 || fail()`, "true", ""},
+		{`"a" && [1]`, "true", ""},
+		{"null || null", "false", ""},
+		{"i = 0; while (i < 10 && i * i < 20) { i = i + 1 }; i", "5", ""},
+		{"false || 1 / 0", "ERROR: 1:12: division by zero 1 / 0", ""},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated, output := evalIO(t, program.Statements, "")
+		if last := evaluated[len(evaluated)-1]; last.Inspect() != tt.res {
+			t.Errorf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+		if output != tt.output {
+			t.Errorf("tests[%d] output should be %q, got %q", i, tt.output, output)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		expr   string
+		res    string
+		output string
+	}{
+		{"x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x", "2", ""},
+		{`s = "ab"; s += "c"`, `"abc"`, ""},
+		{"x = 9223372036854775807; x += 1", "9223372036854775808", ""},
+		{"a, b = 1, 2; a, b = b, a; [a, b]", "[2, 1]", ""},
+		{"a, b = [3, 4]; a * b", "12", ""},
+		{"[x, [y, z]] = [1, [2, 3]]; x + y + z", "6", ""},
+		{`{name, age} = {"name": "Ann", "age": 30}; [name, age]`, `["Ann", 30]`, ""},
+		{`{"name": n, "city": c} = {"name": "Ann"}; [n, c]`, `["Ann", null]`, ""},
+		{"arr = [1, 2, 3]; copy = arr; arr[0] = 10; [arr, copy]", "[[10, 2, 3], [1, 2, 3]]", ""},
+		{"m = [[1, 2], [3, 4]]; m[1][0] += 10; m", "[[1, 2], [13, 4]]", ""},
+		{`h = {}; h["k"] = 1; h["k"] += 1; h`, `{"k": 2}`, ""},
+		{`h = {"a": {"b": 1}}; h["a"]["c"] = 2; h`, `{"a": {"b": 1, "c": 2}}`, ""},
+		{"arr = [1, 2]; i = 0; arr[i], i = 5, 1; [arr, i]", "[[5, 2], 1]", ""},
+		{"s = 0; for (i = 0; i < 5; i += 1) { s += i }; s", "10", ""},
+		{"f = func() { acc = [0, 0]; inc = func(i) { acc[i] += 1 }; inc(0); inc(1); inc(1); acc }; f()", "[1, 2]", ""},
+		{"arr = [1, 2]; arr[0] = 5; copy = arr; arr[1] = 7; [arr, copy]", "[[5, 7], [5, 2]]", ""},
+		{"arr = [0, 0]; arr[0] = 1; id = func(x) { x }; copy = id(arr); arr[1] = 2; [arr, copy]", "[[1, 2], [1, 0]]", ""},
+		{"arr = [0]; arr[0] = 1; get = func() { arr }; copy = get(); arr[0] = 2; [arr, copy]", "[[2], [1]]", ""},
+		{"m = [[0, 0], [0, 0]]; m[0][0] = 1; row = m[0]; m[0][1] = 2; m[1][0] = 3; [m, row]", "[[[1, 2], [3, 0]], [1, 0]]", ""},
+		{`h = {}; h["a"] = 1; copy = h; h["b"] = 2; [len(h), len(copy)]`, "[2, 1]", ""},
+		{"a = [0, 0, 0, 0]; for (i = 1; i < 4; i += 1) { a[i] = a[i - 1] + i }; a", "[0, 1, 3, 6]", ""},
+		{"a = [1, 2]; a[0] = 3; f = func() { a[1] = 5; 0 }; a[f()] = 4; a", "[4, 2]", ""},
+		{"arr = [0]; arr[0] = 7", "7", ""},
+		{"x = 1; x += 2", "3", ""},
+		{"[a, b] = [1, 2]", "[1, 2]", ""},
+		{`f = func() { print("value"); 1 }; arr = [0]; arr[0] += f(); arr`, "[1]", "value \n"},
+		{"[a, b] = [1]", "ERROR: 1:1: cannot destructure array of length 1 into 2 targets", ""},
+		{"[a, b] = 5", "ERROR: 1:1: cannot destructure INTEGER as array", ""},
+		{"{a} = [1]", "ERROR: 1:1: cannot destructure ARRAY as hash", ""},
+		{"x = [1]; x[3] = 1", "ERROR: 1:10: index out of range: 3 with length 1", ""},
+		{"x = [1]; x[-1] += 1", "ERROR: 1:10: negative index: -1", ""},
+		{"x = 5; x[0] = 1", "ERROR: 1:8: index assignment not supported: INTEGER[INTEGER]", ""},
+		{`h = {}; h["a"]["b"] = 1`, "ERROR: 1:9: index assignment not supported: NULL[STRING]", ""},
+		{"h = {}; h[[1]] = 2", "ERROR: 1:9: unusable as hash key: ARRAY", ""},
+		{`x = "s"; x -= 1`, "ERROR: 1:10: type mismatch: STRING - INTEGER", ""},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated, output := evalIO(t, program.Statements, "")
+		if last := evaluated[len(evaluated)-1]; last.Inspect() != tt.res {
+			t.Errorf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+		if output != tt.output {
+			t.Errorf("tests[%d] output should be %q, got %q", i, tt.output, output)
+		}
+	}
+}
+
+func TestShadowing(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  string
+	}{
+		{"x = 10; f = func() { x = x + 1; x }; [f(), x]", "[11, 10]"},
+		{"n = 5; f = func() { n += 1 }; [f(), n]", "[6, 5]"},
+		{"x = 1; f = func() { y = x; x = 2; [y, x] }; [f(), x]", "[[1, 2], 1]"},
+		{"x = 1; f = func() { r = []; for (i = 0; i < 2; i += 1) { r = push(r, x); x = 5 }; r }; f()", "[1, 5]"},
+		{"x = 1; f = func() { g = func() { x }; a = g(); x = 2; [a, g()] }; f()", "[1, 2]"},
+		{"f = func(x) { g = func() { y = x; x = 3; y }; [g(), x] }; f(7)", "[7, 7]"},
+		{"f = func() { r = len([1, 2]); len = 0; r }; f()", "2"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		if last := evaluated[len(evaluated)-1]; last.Inspect() != tt.res {
+			t.Errorf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		expr string
@@ -124,6 +391,8 @@ func TestBooleanExpression(t *testing.T) {
 		{"true || false", true},
 		{"true ^ false", true},
 		{"false ^ false", false},
+		{"\"a\" ^ 0.0", true},
+		{"null ^ []", true},
 		{"5 < 1 || 4 > 2", true},
 		{"true && (false || true)", true},
 		{"5 > 5 || 5 == 5", true},
@@ -139,7 +408,7 @@ func TestBooleanExpression(t *testing.T) {
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		evaluated := eval(program.Statements)
+		evaluated := eval(t, program.Statements)
 
 		if len(evaluated) != 1 {
 			t.Fatalf("tests[%d]: evaluated should have %d objects, got %d", i, 1, len(evaluated))
@@ -156,14 +425,359 @@ func TestBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestStringExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  object.Object
+	}{
+		{`"hello"`, &object.String{Value: "hello"}},
+		{`"hello" + " " + "world"`, &object.String{Value: "hello world"}},
+		{`s = "a\tb"; s + s`, &object.String{Value: "a\tba\tb"}},
+		{`"abc" == "abc"`, evaluator.TRUE},
+		{`"abc" != "abc"`, evaluator.FALSE},
+		{`"abc" < "abd"`, evaluator.TRUE},
+		{`"b" > "abc"`, evaluator.TRUE},
+		{`"abc" == 1`, evaluator.FALSE},
+		{`!""`, evaluator.TRUE},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if !isEqual(last, tt.res) {
+			t.Fatalf("tests[%d] result should be %v, got %v", i, tt.res.Inspect(), last.Inspect())
+		}
+	}
+}
+
+func TestFloatExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  object.Object
+	}{
+		{"3.14", &object.Float{Value: 3.14}},
+		{"1e-9", &object.Float{Value: 1e-9}},
+		{"-2.5E+3", &object.Float{Value: -2500}},
+		{"1.5 + 1.5", &object.Float{Value: 3}},
+		{"1 + 0.5", &object.Float{Value: 1.5}},
+		{"0.5 * 4", &object.Float{Value: 2}},
+		{"10 / 4", &object.Integer{Value: 2}},
+		{"10 / 4.0", &object.Float{Value: 2.5}},
+		{"1 - 0.25", &object.Float{Value: 0.75}},
+		{"1 == 1.0", evaluator.TRUE},
+		{"0.1 + 0.2 != 0.3", evaluator.TRUE},
+		{"2 < 2.5", evaluator.TRUE},
+		{"2.5 > 3", evaluator.FALSE},
+		{"!0.0", evaluator.TRUE},
+		{"0.5 && 1", evaluator.TRUE},
+		{`{1.5: "a"}[1.5]`, &object.String{Value: "a"}},
+		{`{0.0: "zero"}[-0.0]`, &object.String{Value: "zero"}},
+		{"int(3.9)", &object.Integer{Value: 3}},
+		{"int(-3.9)", &object.Integer{Value: -3}},
+		{`int(" 42 ")`, &object.Integer{Value: 42}},
+		{"int(7)", &object.Integer{Value: 7}},
+		{"float(2)", &object.Float{Value: 2}},
+		{`float("1e3")`, &object.Float{Value: 1000}},
+		{"round(2.5)", &object.Integer{Value: 3}},
+		{"round(-2.5)", &object.Integer{Value: -3}},
+		{"floor(-1.5)", &object.Integer{Value: -2}},
+		{"ceil(1.2)", &object.Integer{Value: 2}},
+		{"ceil(4)", &object.Integer{Value: 4}},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if !isEqual(last, tt.res) {
+			t.Fatalf("tests[%d] result should be %v, got %v", i, tt.res.Inspect(), last.Inspect())
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for i, tt := range tests {
+		if s := (&object.Float{Value: tt.value}).Inspect(); s != tt.expected {
+			t.Errorf("tests[%d] Inspect should be %q, got %q", i, tt.expected, s)
+		}
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	tests := []struct {
+		expr     string
+		typ      object.ObjectType
+		expected string
+	}{
+		{"9223372036854775807 + 1", object.BIGINT_OBJ, "9223372036854775808"},
+		{"-9223372036854775807 - 1 - 1", object.BIGINT_OBJ, "-9223372036854775809"},
+		{"4294967296 * 4294967296", object.BIGINT_OBJ, "18446744073709551616"},
+		{"100000000000000000000", object.BIGINT_OBJ, "100000000000000000000"},
+		{"-100000000000000000000", object.BIGINT_OBJ, "-100000000000000000000"},
+		{"x = 100000000000000000000; x - x", object.INTEGER_OBJ, "0"},
+		{"(9223372036854775807 + 1) - 1", object.INTEGER_OBJ, "9223372036854775807"},
+		{"(-9223372036854775807 - 1) / -1", object.BIGINT_OBJ, "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", object.BIGINT_OBJ, "9223372036854775808"},
+		{"100000000000000000000 / 3", object.BIGINT_OBJ, "33333333333333333333"},
+		{"-100000000000000000000 / 3", object.BIGINT_OBJ, "-33333333333333333333"},
+		{"fact = func(n, acc) { if (n == 0) { acc } else { fact(n - 1, acc * n) } }; fact(25, 1)", object.BIGINT_OBJ, "15511210043330985984000000"},
+		{"100000000000000000000 > 1", object.BOOLEAN_OBJ, "true"},
+		{"100000000000000000000 == 100000000000000000000", object.BOOLEAN_OBJ, "true"},
+		{"100000000000000000000 != 1", object.BOOLEAN_OBJ, "true"},
+		{"100000000000000000000 * 0.5", object.FLOAT_OBJ, "5e+19"},
+		{`{100000000000000000000: "big"}[10000000000 * 10000000000]`, object.STRING_OBJ, `"big"`},
+		{`int("123456789012345678901234567890")`, object.BIGINT_OBJ, "123456789012345678901234567890"},
+		{"float(100000000000000000000)", object.FLOAT_OBJ, "1e+20"},
+		{"ceil(1e20)", object.BIGINT_OBJ, "100000000000000000000"},
+		{"sum(9223372036854775807, 1)", object.BIGINT_OBJ, "9223372036854775808"},
+		{"!100000000000000000000", object.BOOLEAN_OBJ, "false"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Type() != tt.typ || last.Inspect() != tt.expected {
+			t.Errorf("tests[%d] result should be %s %s, got %s %s", i, tt.typ, tt.expected, last.Type(), last.Inspect())
+		}
+	}
+}
+
+func TestArrayExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  string
+	}{
+		{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{"[]", "[]"},
+		{"[1, 2, 3][0]", "1"},
+		{"arr = [1, 2, 3]; arr[1] + arr[2]", "5"},
+		{"i = 0; [[1, 2], [3]][i + 1][0]", "3"},
+		{`len([1, 2]) + len("Жук")`, "5"},
+		{"first([7, 8])", "7"},
+		{"last([7, 8])", "8"},
+		{"first([])", "null"},
+		{"rest([1, 2, 3])", "[2, 3]"},
+		{"rest([])", "null"},
+		{"arr = [1]; push(arr, 2); arr", "[1]"},
+		{"push([1], 2)", "[1, 2]"},
+		{"slice([1, 2, 3, 4], 1, 3)", "[2, 3]"},
+		{"slice([1, 2, 3, 4], 2)", "[3, 4]"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestHashExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  string
+	}{
+		{`{"a": 1, 2: "b", true: [3]}`, `{"a": 1, 2: "b", true: [3]}`},
+		{`h = {"one": 1, "two": 2}; h["one"] + h["two"]`, "3"},
+		{`{"a": 1}["b"]`, "null"},
+		{`k = "x"; {k + "y": 5}["xy"]`, "5"},
+		{`{1: "a", 1: "b"}`, `{1: "b"}`},
+		{`keys({"a": 1, "b": 2})`, `["a", "b"]`},
+		{`values({"a": 1, "b": 2})`, "[1, 2]"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, 1)`, "false"},
+		{`{1: "a"}[1.0]`, `"a"`},
+		{`h = {}; h[2.0] = "b"; h[2]`, `"b"`},
+		{`has({0: 1}, -0.0)`, "true"},
+		{`{100000000000000000000: "big"}[1e20]`, `"big"`},
+		{`len({1: "a", 1.0: "b", 1.5: "c"})`, "2"},
+		{`{1.5: "c"}[1.5]`, `"c"`},
+		{`h = {"a": 1, "b": 2}; delete(h, "a")`, `{"b": 2}`},
+		{`h = {"a": 1, "b": 2}; delete(h, "a"); h`, `{"a": 1, "b": 2}`},
+		{`len({"a": 1})`, "1"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  string
+	}{
+		{"i = 0; while (i < 10) { i = i + 1 }; i", "10"},
+		{"s = 0; for (i = 0; i < 5; i = i + 1) { s = s + i }; s", "10"},
+		{"i = 0; while (true) { i = i + 1; if (i == 3) { break } }; i", "3"},
+		{"s = 0; for (i = 0; i < 5; i = i + 1) { if (i == 2) { continue }; s = s + i }; s", "8"},
+		{"n = 0; for (i = 0; i < 3; i = i + 1) { for (j = 0; j < 3; j = j + 1) { if (j == 1) { break }; n = n + 1 } }; n", "3"},
+		{"f = func() { while (true) { return 7 } }; f()", "7"},
+		{"i = 0; for (;;) { i = i + 1; if (i > 4) { break } }; i", "5"},
+		{"while (false) { 1 }", "null"},
+		{"r = []; for (j = 0; j < 3; j = j + 1) { if (j > 0) { r = push(r, prev) }; prev = j }; r", "[0, 1]"},
+		{"i = 0; s = 0; while (i < 3) { if (i > 0) { s += last }; last = i * 10; i += 1 }; s", "10"},
+		{"f = func() { r = []; for (j = 0; j < 3; j = j + 1) { if (j > 0) { r = push(r, prev) }; prev = j }; r }; f()", "[0, 1]"},
+		{"f = func() { while (false) { w }; w = 1 }; f()", "1"},
+		{"i = 0; while (i < 1000000) { i = i + 1 }; i", "1000000"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestForkExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  string
+	}{
+		{"f = func(x) { x * 2 }; t = fork f(21); await(t)", "42"},
+		{"sq = func(x) { x * x }; awaitAll([fork sq(1), fork sq(2), fork sq(3)])", "[1, 4, 9]"},
+		{"awaitAll([])", "[]"},
+		{`t = fork func() { "done" }(); await(t); await(t)`, `"done"`},
+		{`base = 10; add = func(x) { for (i = 0; i < 100; i = i + 1) { x = x + 1 }; base + x }
+		awaitAll([fork add(1), fork add(2)])`, "[111, 112]"},
+		{`deep = func(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } }
+		awaitAll([fork deep(5000), fork deep(5000), fork deep(5000)])`, "[5000, 5000, 5000]"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+// TestForkSharedVariables проверяется с -race: задачи одновременно читают и изменяют общую глобальную переменную
+func TestForkSharedVariables(t *testing.T) {
+	input := `g = [0]
+	inc = func() { for (i = 0; i < 500; i += 1) { g[0] = g[0] + 1 }; g[0] }
+	watch = func() { last = 0; ok = true; for (i = 0; i < 500; i += 1) { if (g[0] < last) { ok = false }; last = g[0] }; ok }
+	awaitAll([fork inc(), fork watch(), fork watch()])`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	evaluated := eval(t, program.Statements)
+	if last := evaluated[len(evaluated)-1]; last.Inspect() != "[500, true, true]" {
+		t.Fatalf("result should be [500, true, true], got %s", last.Inspect())
+	}
+}
+
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		expr string
+		res  string
+	}{
+		{"ch = chan(1); send(ch, 5); recv(ch)", "[5, true]"},
+		{"ch = chan(); close(ch); recv(ch)", "[null, false]"},
+		{`ch = chan()
+		producer = func(n) { for (i = 0; i < n; i = i + 1) { send(ch, i) }; close(ch) }
+		fork producer(4)
+		s = 0
+		while (true) {
+			r = recv(ch)
+			if (!r[1]) { break }
+			s = s + r[0]
+		}
+		s`, "6"},
+		{`a = chan(); b = chan(1); send(b, "b"); select([a, b])`, `[1, "b", true]`},
+		{"a = chan(); select([a], 10)", "null"},
+		{"a = chan(); close(a); select([a], 10)", "[0, null, false]"},
+		{"chan(3)", "<channel 0/3>"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.expr)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+	}
+}
+
 func TestBlockStatement(t *testing.T) {
 	tests := []struct {
 		expr string
 		res  object.Object
 	}{
 		{"{1;2}", &object.Integer{Value: 2}},
-		{"{}", NULL},
-		{"{false}", FALSE},
+		{"{}", evaluator.NULL},
+		{"{false}", evaluator.FALSE},
 	}
 
 	for i, tt := range tests {
@@ -172,7 +786,7 @@ func TestBlockStatement(t *testing.T) {
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		evaluated := eval(program.Statements)
+		evaluated := eval(t, program.Statements)
 
 		if len(evaluated) != 1 {
 			t.Fatalf("tests[%d]: evaluated should have %d objects, got %d", i, 1, len(evaluated))
@@ -192,12 +806,58 @@ func TestWithError(t *testing.T) {
 		{"5 / 0", "division by zero 5 / 0"},
 		{"func(x,y) {x + y}(1)", "function expects 2 arguments, 1 was given"},
 		{"func() {1} + 5", "type mismatch: FUNCTION + INTEGER"},
-		{"b = 1 + a", "identifier not found: a"},
+		{"func(c) { if (c) { a = 1 }; a }(false)", "identifier not found: a"},
+		{"y = x; x = 1", "identifier not found: x"},
+		{"func() { w; w = 1 }()", "identifier not found: w"},
 		{"1(5)", "not a function: INTEGER"},
 		{"1 + true", "type mismatch: INTEGER + BOOLEAN"},
 		{"true + true", "unknown operator: BOOLEAN + BOOLEAN"},
 		{"-true", "unknown operator: -BOOLEAN"},
-		{"{f = func(){f()};f()}", "max recursion level reached"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{`"a" + 1`, "type mismatch: STRING + INTEGER"},
+		{"[1, 2][-1]", "negative index: -1"},
+		{"[1, 2][2]", "index out of range: 2 with length 2"},
+		{"1[0]", "index operator not supported: INTEGER[INTEGER]"},
+		{"len(1)", "len expects string, array or hash. got=INTEGER"},
+		{"slice([1, 2], 2, 1)", "invalid slice bounds: 2 > 1"},
+		{"slice([1, 2], 0, 3)", "index out of range: 3 with length 2"},
+		{"{func(){1}: 1}", "unusable as hash key: FUNCTION"},
+		{`{"a": 1}[func(){1}]`, "unusable as hash key: FUNCTION"},
+		{`has({"a": 1}, [1])`, "unusable as hash key: ARRAY"},
+		{"{f = func(){1 + f()};f()}", "max recursion level reached"},
+		{"{t = func(n) { try { t(n + 1) } catch (e) { -1 } }; t(0)}", "max recursion level reached"},
+		{"{t = func(n) { try { if (n == 0) { 0 } else { t(n - 1) } } catch (e) { -1 } finally { 0 } }; t(300000)}", "max recursion level reached"},
+		{"break", "break outside loop"},
+		{"while (true) { f = func() { continue }; f() }", "continue outside loop"},
+		{"while (1 + true) { 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"await(fork func() { 1 + true }())", "type mismatch: INTEGER + BOOLEAN"},
+		{"awaitAll([fork func() { 1 }(), fork func(x) { x }()])", "function expects 1 arguments, 0 was given"},
+		{"fork 1(2)", "not a function: INTEGER"},
+		{"await(1)", "await expects task. got=INTEGER"},
+		{"{ch = chan(); close(ch); send(ch, 1)}", "send on closed channel"},
+		{"{ch = chan(); close(ch); close(ch)}", "close of closed channel"},
+		{"chan(-1)", "negative channel capacity: -1"},
+		{"chan(100000000000000)", "channel capacity 100000000000000 is too large, at most 16777216"},
+		{"select([1])", "select expects array of channels. got element INTEGER"},
+		{`import "lib.mlang" as lib`, `import is not available: "lib.mlang"`},
+		{`"a".b`, "selector not supported: STRING.b"},
+		{"1.5 / 0", "division by zero 1.5 / 0"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{`int("1.5")`, `int: invalid integer "1.5"`},
+		{`float("x")`, `float: invalid number "x"`},
+		{"round([1])", "round expects number. got=ARRAY"},
+		{"round(1e300 * 1e300)", "round: +Inf is not a finite number"},
+		{"5 % 0", "division by zero 5 % 0"},
+		{"5 ~/ 0", "division by zero 5 ~/ 0"},
+		{"1.5 % 0", "division by zero 1.5 % 0"},
+		{"1 << -1", "negative shift count -1"},
+		{"100000000000000000000 >> -1", "negative shift count -1"},
+		{"10 ** 10 ** 10", "integer too large: 10 ** 10000000000"},
+		{"1 << 100000000", "integer too large: 1 << 100000000"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{`"a" | "b"`, "unknown operator: STRING | STRING"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+		{"1 >= true", "type mismatch: INTEGER >= BOOLEAN"},
 	}
 
 	for i, tt := range tests {
@@ -206,7 +866,7 @@ func TestWithError(t *testing.T) {
 		program := p.ParseProgram()
 		checkParserErrors(t, p)
 
-		evaluated := eval(program.Statements)
+		evaluated := eval(t, program.Statements)
 
 		if len(evaluated) != 1 {
 			t.Fatalf("tests[%d]: evaluated should have %d objects, got %d", i, 1, len(evaluated))
@@ -223,6 +883,348 @@ func TestWithError(t *testing.T) {
 	}
 }
 
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"5 / 0", "ERROR: 1:3: division by zero 5 / 0"},
+		{"if (false) { x = 1 }\ny = x", "ERROR: 2:5: identifier not found: x"},
+		{"f = func(a) {\n\ta + true\n}\nf(1)", "ERROR: 2:4: type mismatch: INTEGER + BOOLEAN"},
+		{"len(1, 2)", "ERROR: 1:4: len expects only one argument, 2 was given"},
+		{"\n  break", "ERROR: 2:3: break outside loop"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.err {
+			t.Fatalf("tests[%d] error should be %q, got %q", i, tt.err, last.Inspect())
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `g = func(x) {
+	x + true
+}
+h = {"f": func(n) { if (n == 0) { 1 * g(n) } else { 1 * h["f"](n - 1) } }}
+h["f"](2)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	evaluated := eval(t, program.Statements)
+	err, ok := evaluated[len(evaluated)-1].(*object.Error)
+	if !ok {
+		t.Fatalf("last result should be error, got %T", evaluated[len(evaluated)-1])
+	}
+
+	expected := []string{
+		"g(1 arg) at 4:40",
+		`(h["f"])(1 arg) at 4:63`,
+		`(h["f"])(1 arg) at 4:63`,
+		`(h["f"])(1 arg) at 5:7`,
+	}
+	if len(err.Stack) != len(expected) {
+		t.Fatalf("err.Stack should have %d frames, got %d", len(expected), len(err.Stack))
+	}
+	for i, frame := range err.Stack {
+		if frame.String() != expected[i] {
+			t.Errorf("err.Stack[%d] should be %q, got %q", i, expected[i], frame.String())
+		}
+	}
+
+	trace := "Traceback (most recent call first):\n" +
+		"  g(1 arg) at 4:40\n" +
+		"  (h[\"f\"])(1 arg) at 4:63\n" +
+		"  [previous call repeated 1 more times]\n" +
+		"  (h[\"f\"])(1 arg) at 5:7\n"
+	if err.StackTrace() != trace {
+		t.Errorf("err.StackTrace() should be %q, got %q", trace, err.StackTrace())
+	}
+}
+
+func TestErrorWithoutStackTrace(t *testing.T) {
+	tests := []string{
+		"1 + true",
+		"f = func(x) { x }; f()",
+		"len(1)",
+	}
+
+	for i, input := range tests {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		err, ok := evaluated[len(evaluated)-1].(*object.Error)
+		if !ok {
+			t.Fatalf("tests[%d] last result should be error, got %T", i, evaluated[len(evaluated)-1])
+		}
+		if len(err.Stack) != 0 {
+			t.Errorf("tests[%d] err.Stack should be empty, got %v", i, err.Stack)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input string
+		res   string
+	}{
+		{"sum = func(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(200000, 0)", "20000100000"},
+		{"even = func(n) { if (n == 0) { true } else { odd(n - 1) } }; odd = func(n) { if (n == 0) { false } else { even(n - 1) } }; even(200001)", "false"},
+		{"f = func(n) { while (true) { return if (n == 0) { 0 } else { f(n - 1) } } }; f(200000)", "0"},
+		{"f = func(n) { if (n > 0) { return f(n - 1) }; 7 }; f(200000)", "7"},
+		{"f = func(a) { len(a) }; f([1, 2])", "2"},
+		{"f = func() { g(1) }; g = func() { 1 }; f()", "ERROR: 1:15: function expects 0 arguments, 1 was given"},
+		{"g = func(x) { x + true }; f = func(n) { g(n) }; f(1)", "ERROR: 1:17: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %q, got %q", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input string
+		res   string
+	}{
+		{"try { 1 } catch (e) { 2 }", "1"},
+		{"try { 1 / 0 } catch (e) { [e[\"kind\"], e[\"message\"], e[\"position\"], e[\"value\"]] }", `["division", "division by zero 1 / 0", "1:9", null]`},
+		{"try { readInt() } catch (e) { e[\"kind\"] }", `"eof"`},
+		{"try { [1][5] } catch (e) { e[\"kind\"] }", `"index"`},
+		{"try { 1 + true } catch (e) { e[\"kind\"] }", `"type"`},
+		{"try { len(1, 2) } catch (e) { e[\"kind\"] }", `"runtime"`},
+		{"try { throw \"boom\" } catch (e) { [e[\"message\"], e[\"kind\"], e[\"value\"]] }", `["boom", "error", "boom"]`},
+		{"try { throw 42 } catch (e) { [e[\"message\"], e[\"value\"] + 1] }", `["42", 43]`},
+		{"try { throw {\"message\": \"bad\", \"kind\": \"validation\", \"code\": 3} } catch (e) { [e[\"kind\"], e[\"value\"][\"code\"]] }", `["validation", 3]`},
+		{"try { try { [1][5] } catch (e) { throw e } } catch (e) { [e[\"kind\"], e[\"message\"], e[\"value\"]] }", `["index", "index out of range: 5 with length 1", null]`},
+		{"try { try { throw \"a\" } catch (e) { throw \"b\" } } catch (e) { e[\"message\"] }", `"b"`},
+		{"try { try { 1 } finally { throw \"f\" } } catch (e) { e[\"message\"] }", `"f"`},
+		{"[1, 2, try { 3 + [4, 1 / 0][0] } catch (e) { 5 }]", "[1, 2, 5]"},
+		{"f = func() { try { throw \"a\" } catch (err) { err[\"message\"] } }; f()", `"a"`},
+		{"f = func(n) { if (n == 0) { readInt() } else { 1 + f(n - 1) } }; try { f(3) } catch (e) { e[\"message\"] }", `"readInt: end of input"`},
+		{"f = func(n) { try { if (n == 0) { throw \"done\" }; f(n - 1) } catch (e) { e[\"message\"] } }; f(100)", `"done"`},
+		{"try { await(fork func() { throw \"t\" }()) } catch (e) { e[\"message\"] }", `"t"`},
+		{"throw \"boom\"", "ERROR: 1:1: boom"},
+		{"f = func() { throw [1] }; f()", "ERROR: 1:14: [1]"},
+		{"try { 1 + true } finally { 2 }", "ERROR: 1:9: type mismatch: INTEGER + BOOLEAN"},
+		{"g = func() { throw \"x\" }; f = func() { try { 1 + g() } finally { 0 } }; 1 * f()", "ERROR: 1:14: x"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Errorf("tests[%d] result should be %q, got %q", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestFinally(t *testing.T) {
+	tests := []struct {
+		input string
+		res   string
+	}{
+		{"r = try { log = push(log, 1); 10 } finally { log = push(log, 2); 20 }; [r, log]", "[10, [1, 2]]"},
+		{"r = try { throw 1 } catch (e) { log = push(log, \"c\"); 1 } finally { log = push(log, \"f\") }; [r, log]", `[1, ["c", "f"]]`},
+		{"try { try { 1 + true } finally { log = push(log, 1) } } catch (e) { [e[\"kind\"], log] }", `["type", [1]]`},
+		{"c = chan(2); f = func() { try { return 1 } finally { send(c, \"f\") }; 2 }; [f(), recv(c)[0]]", `[1, "f"]`},
+		{"f = func() { try { return 1 } finally { return 2 } }; f()", "2"},
+		{"f = func() { try { throw 1 } finally { return 2 } }; f()", "2"},
+		{"c = chan(2); f = func() { try { try { return 1 } finally { send(c, 1) } } finally { send(c, 2) } }; [f(), recv(c)[0], recv(c)[0]]", "[1, 1, 2]"},
+		{"for (i = 0; i < 3; i = i + 1) { try { if (i == 1) { break }; log = push(log, i) } finally { log = push(log, \"f\") } }; log", `[0, "f", "f"]`},
+		{"for (i = 0; i < 3; i = i + 1) { try { if (i == 1) { continue }; log = push(log, i) } finally { log = push(log, \"f\") } }; log", `[0, "f", "f", 2, "f"]`},
+		{"while (true) { try { while (true) { break } ; log = push(log, 1); break } finally { log = push(log, 2) } }; log", "[1, 2]"},
+		{"f = func() { s = 0; while (true) { try { if (s > 5) { break }; s = s + 2 } catch (e) { 0 } }; s }; f()", "6"},
+		{"f = func() { try { break } catch (e) { \"caught\" } }; try { f() } catch (e) { e[\"message\"] }", `"break outside loop"`},
+		{"i = 0; while (i < 3) { i = i + 1; try { 1 / 0 } catch (e) { continue } finally { log = push(log, i) } }; log", "[1, 2, 3]"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New("log = []; " + tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		evaluated := eval(t, program.Statements)
+		last := evaluated[len(evaluated)-1]
+
+		if last.Inspect() != tt.res {
+			t.Errorf("tests[%d] result should be %q, got %q", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits evaluator.Limits
+		err    error
+	}{
+		{"while (true) { 1 }", evaluator.Limits{MaxSteps: 1000}, evaluator.ErrStepLimit},
+		{"x = 0; forn(1000, func() { x = 1 })", evaluator.Limits{MaxSteps: 1000}, evaluator.ErrStepLimit},
+		{"await(fork func() { while (true) { 1 } }())", evaluator.Limits{MaxSteps: 1000}, evaluator.ErrStepLimit},
+		{"f = func(n) { 1 + f(n + 1) }; f(0)", evaluator.Limits{MaxDepth: 10}, evaluator.ErrDepthLimit},
+		{"a = []; while (true) { a = push(a, 1) }", evaluator.Limits{MaxAllocations: 1000}, evaluator.ErrAllocationLimit},
+		{"ch = chan(5000)", evaluator.Limits{MaxAllocations: 1000}, evaluator.ErrAllocationLimit},
+		{"try { while (true) { 1 } } catch (e) { 0 } finally { 0 }", evaluator.Limits{MaxSteps: 1000}, evaluator.ErrStepLimit},
+		{"f = func(n) { if (n == 100) { n } else { f(n + 1) } }; f(0)", evaluator.Limits{MaxDepth: 10}, nil},
+		{"s = 0; for (i = 0; i < 10; i = i + 1) { s = s + i }; s", evaluator.Limits{MaxSteps: 1000, MaxAllocations: 1000}, nil},
+	}
+
+	for i, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		interpreter := evaluator.NewInterpreter(resolve(t, program), tt.limits)
+		results := interpreter.Run(context.Background(), program)
+		err, _ := results[len(results)-1].(*object.Error)
+
+		if tt.err == nil {
+			if err != nil {
+				t.Errorf("tests[%d] should not fail, got %q", i, err.Inspect())
+			}
+			continue
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("tests[%d] error should be %q, got %v", i, tt.err, results[len(results)-1])
+		}
+	}
+}
+
+func TestLimitsPerRun(t *testing.T) {
+	program := parser.New(lexer.New("s = 0; for (i = 0; i < 10; i = i + 1) { s = s + i }")).ParseProgram()
+	interpreter := evaluator.NewInterpreter(resolve(t, program), evaluator.Limits{MaxSteps: 500})
+
+	for run := 0; run < 3; run++ {
+		results := interpreter.Run(context.Background(), program)
+		if err, ok := results[len(results)-1].(*object.Error); ok {
+			t.Fatalf("run %d should not fail, got %q", run, err.Inspect())
+		}
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	program := parser.New(lexer.New("while (true) { 1 }")).ParseProgram()
+	interpreter := evaluator.NewInterpreter(resolve(t, program), evaluator.Limits{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	results := interpreter.Run(ctx, program)
+
+	err, ok := results[len(results)-1].(*object.Error)
+	if !ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("result should be deadline error, got %v", results[len(results)-1])
+	}
+	if err.Message != "context deadline exceeded" {
+		t.Errorf("error message should be %q, got %q", "context deadline exceeded", err.Message)
+	}
+}
+
+func TestCancelBlocking(t *testing.T) {
+	tests := []string{
+		"await(fork recv(chan()))",
+		"awaitAll([fork recv(chan())])",
+		"send(chan(), 1)",
+		"recv(chan())",
+		"select([chan()])",
+		"select([chan()], 100000)",
+		"readLine()",
+		"readInt()",
+		"readWords()",
+		"readAll()",
+		"read()",
+		"eof()",
+	}
+
+	for i, input := range tests {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		interpreter := evaluator.NewInterpreter(resolve(t, program), evaluator.Limits{})
+		stdin, _ := io.Pipe()
+		interpreter.Context = object.NewContext(stdin, ioutil.Discard, ioutil.Discard)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		results := interpreter.Run(ctx, program)
+		cancel()
+
+		err, ok := results[len(results)-1].(*object.Error)
+		if !ok || !errors.Is(err, context.DeadlineExceeded) || err.Kind != object.LIMIT_ERROR {
+			t.Errorf("tests[%d] result should be deadline error, got %v", i, results[len(results)-1])
+		}
+	}
+}
+
+func TestIO(t *testing.T) {
+	tests := []struct {
+		input  string
+		stdin  string
+		output string
+		res    string
+	}{
+		{`print("a", 1, [2])`, "", "a 1 [2] \n", "null"},
+		{"read() + read()", "5\n3\n", "", "8"},
+		{"read()", "", "", "null"},
+		{"print(read()); print(read())", "1 2", "1 \n2 \n", "null"},
+		{"i = 0; forn(2, func() { print(i) })", "", "0 \n1 \n", "null"},
+		{"await(fork func() { print(read()) }())", "7", "7 \n", "null"},
+		{"[readLine(), readLine(), readLine()]", "a b\r\n\nc", "", `["a b", "", "c"]`},
+		{"readLine(); readLine()", "a\n", "", "ERROR: 1:21: readLine: end of input"},
+		{"readLine(); readAll()", "a\nb c\nd", "", `"b c\nd"`},
+		{"readAll(); readAll()", "a", "", `""`},
+		{"readInt() + readInt()", "  12\n\t-30 ", "", "-18"},
+		{"readInt(); readLine()", "1 rest\n", "", `" rest"`},
+		{"readInt() + 1", "100000000000000000000", "", "100000000000000000001"},
+		{"readInt()", "-9223372036854775809", "", "-9223372036854775809"},
+		{"readInt()", "12a", "", `ERROR: 1:8: readInt: invalid integer "12a"`},
+		{"readInt()", " \n", "", "ERROR: 1:8: readInt: end of input"},
+		{"[readWords(), readWords()]", " a  bc \n\n", "", `[["a", "bc"], []]`},
+		{"readWords()", "", "", "ERROR: 1:10: readWords: end of input"},
+		{"[eof(), readLine(), eof()]", "x", "", `[false, "x", true]`},
+		{"[eof(), readLine(), eof()]", "\n\n", "", `[false, "", false]`},
+		{"n = 0; while (!eof()) { n = n + len(readWords()) }; n", "a b\nc\n", "", "3"},
+		{"readLine(1)", "", "", "ERROR: 1:9: readLine expects no arguments"},
+	}
+
+	for i, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated, output := evalIO(t, program.Statements, tt.stdin)
+
+		if output != tt.output {
+			t.Errorf("tests[%d] output should be %q, got %q", i, tt.output, output)
+		}
+		if last := evaluated[len(evaluated)-1]; last.Inspect() != tt.res {
+			t.Errorf("tests[%d] result should be %q, got %q", i, tt.res, last.Inspect())
+		}
+	}
+}
+
 /*func TestRecursion(t *testing.T) {
 	input := `f = func(){f()}; f()`
 
@@ -231,7 +1233,7 @@ func TestWithError(t *testing.T) {
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	evaluated := eval(program.Statements)
+	evaluated := eval(t, program.Statements)
 
 	if len(evaluated) != 2 {
 		t.Fatalf("evaluated should have %d objects, go")
@@ -247,7 +1249,58 @@ func isEqual(a object.Object, b object.Object) bool {
 	case *object.Integer:
 		t, _ := b.(*object.Integer)
 		return a.Value == t.Value
+	case *object.BigInt:
+		t, _ := b.(*object.BigInt)
+		return a.Value.Cmp(t.Value) == 0
+	case *object.Float:
+		t, _ := b.(*object.Float)
+		return a.Value == t.Value
+	case *object.String:
+		t, _ := b.(*object.String)
+		return a.Value == t.Value
 	default:
 		return a == b
 	}
 }
+
+// BenchmarkIndexAssignment присваивает каждому элементу массива из 10000 элементов. Массив принадлежит
+// переменной и изменяется на месте, поэтому время запуска растет линейно с длиной массива, а не квадратично
+func BenchmarkIndexAssignment(b *testing.B) {
+	const n = 10000
+	program := parser.New(lexer.New("for (i = 1; i < len(a); i += 1) { a[i] = a[i - 1] + 1 }; a[n - 1]")).ParseProgram()
+	globals := object.NewEnvironment()
+	slot := globals.Define("a")
+	globals.Set(0, globals.Define("n"), &object.Integer{Value: n})
+	if errors := resolver.Resolve(program, globals); len(errors) != 0 {
+		b.Fatalf("resolver errors: %v", errors)
+	}
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+
+	runs := map[string]func() []object.Object{
+		"eval": func() []object.Object {
+			return evaluator.NewInterpreter(globals, evaluator.Limits{}).Run(context.Background(), program)
+		},
+		"vm": func() []object.Object {
+			ctx := object.NewContext(strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+			return vm.New(c.Bytecode(), globals, ctx).Run()
+		},
+	}
+	for name, run := range runs {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				elements := make([]object.Object, n)
+				for j := range elements {
+					elements[j] = &object.Integer{Value: 0}
+				}
+				globals.Set(0, slot, &object.Array{Elements: elements})
+				results := run()
+				if last := results[len(results)-1]; last.Inspect() != "9999" {
+					b.Fatalf("result should be 9999, got %s", last.Inspect())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"mlang/ast"
+	"mlang/object"
+	"os"
+	"sync/atomic"
+)
+
+// Ошибки превышения ограничений. Ошибка выполнения, вызванная ограничением, содержит одну из них
+// (или ошибку контекста) и проверяется через errors.Is
+var (
+	ErrStepLimit       = errors.New("step limit exceeded")
+	ErrDepthLimit      = errors.New("call depth limit exceeded")
+	ErrAllocationLimit = errors.New("allocation limit exceeded")
+)
+
+// stdContext окружение встроенных функций со стандартными потоками ввода-вывода процесса
+var stdContext = object.NewContext(os.Stdin, os.Stdout, os.Stderr)
+
+// CONTEXT_CHECK_INTERVAL число шагов между проверками отмены контекста
+const CONTEXT_CHECK_INTERVAL = 1 << 10
+
+// Limits ограничения выполнения программы. Нулевое значение поля означает отсутствие ограничения
+type Limits struct {
+	MaxSteps       int64 // число вычисленных узлов синтаксического дерева
+	MaxDepth       int   // глубина вызовов пользовательских функций, хвостовые вызовы ее не увеличивают
+	MaxAllocations int64 // число созданных значений, массивы и словари считаются вместе с элементами, каналы - с буфером
+}
+
+// Interpreter выполняет программы в общем окружении глобальных переменных. Ограничения действуют
+// на каждый вызов Run отдельно и общие для всех задач, запущенных программой через fork
+type Interpreter struct {
+	Limits  Limits
+	Context *object.Context // потоки ввода-вывода встроенных функций, по умолчанию стандартные
+	env     *object.Environment
+}
+
+// NewInterpreter создает интерпретатор с окружением env, в котором разрешены имена программ (пакет resolver)
+func NewInterpreter(env *object.Environment, limits Limits) *Interpreter {
+	return &Interpreter{Limits: limits, Context: stdContext, env: env}
+}
+
+// Run выполняет программу и возвращает результаты инструкций верхнего уровня, как EvalProgram.
+// При превышении ограничения или отмене ctx последним результатом будет ошибка с причиной
+// ErrStepLimit, ErrDepthLimit, ErrAllocationLimit или ctx.Err(). Модуль, импортированный программой,
+// получает в ctx ее счетчики и продолжает их вместо собственных ограничений
+func (in *Interpreter) Run(ctx context.Context, program *ast.Program) []object.Object {
+	return newThread(in.limiter(ctx), in.Context).evalProgram(program.Statements, in.env)
+}
+
+// Call вызывает функцию программы или встроенную функцию с теми же ограничениями, что и Run
+func (in *Interpreter) Call(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	return newThread(in.limiter(ctx), in.Context).applyFunction(fn, args)
+}
+
+// limiter возвращает счетчики программы, переданные в ctx, или новые счетчики с ограничениями интерпретатора
+func (in *Interpreter) limiter(ctx context.Context) *limiter {
+	if l, ok := ctx.Value(limiterKey{}).(*limiter); ok {
+		return l
+	}
+	return &limiter{ctx: ctx, limits: in.Limits}
+}
+
+// limiterKey ключ счетчиков программы в контексте, с которым выполняются импортированные ею модули
+type limiterKey struct{}
+
+// limiter счетчики одного запуска программы, общие для всех ее потоков
+type limiter struct {
+	ctx         context.Context
+	limits      Limits
+	steps       int64
+	allocations int64
+}
+
+// context возвращает контекст выполнения вместе со счетчиками
+func (l *limiter) context() context.Context {
+	return context.WithValue(l.ctx, limiterKey{}, l)
+}
+
+func unlimited() *limiter {
+	return &limiter{ctx: context.Background()}
+}
+
+// step учитывает вычисление очередного узла
+func (l *limiter) step() *object.Error {
+	steps := atomic.AddInt64(&l.steps, 1)
+	if l.limits.MaxSteps > 0 && steps > l.limits.MaxSteps {
+		return limitError(ErrStepLimit)
+	}
+	if steps%CONTEXT_CHECK_INTERVAL == 0 {
+		if err := l.ctx.Err(); err != nil {
+			return limitError(err)
+		}
+	}
+	return nil
+}
+
+// allocate учитывает созданное значение и возвращает его или ошибку превышения ограничения
+func (l *limiter) allocate(obj object.Object) object.Object {
+	if l.limits.MaxAllocations == 0 {
+		return obj
+	}
+
+	var size int64
+	switch obj := obj.(type) {
+	case *object.Error, *object.Null, *object.Boolean:
+		return obj
+	case *object.Array:
+		size = 1 + int64(len(obj.Elements))
+	case *object.Hash:
+		size = 1 + int64(obj.Len())
+	case *object.Channel:
+		size = 1 + int64(cap(obj.Ch))
+	default:
+		size = 1
+	}
+
+	if atomic.AddInt64(&l.allocations, size) > l.limits.MaxAllocations {
+		return limitError(ErrAllocationLimit)
+	}
+	return obj
+}
+
+func limitError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Kind: object.LIMIT_ERROR, Err: err}
+}
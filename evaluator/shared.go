@@ -0,0 +1,92 @@
+package evaluator
+
+/*
+	Операции, общие для вычислителя и виртуальной машины (пакет vm),
+	чтобы оба способа выполнения давали одинаковые результаты и ошибки
+*/
+
+import (
+	"context"
+	"mlang/object"
+)
+
+func EvalInfix(operator string, left object.Object, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// AddIntegers, SubIntegers и MulIntegers выполняют операции над int64, при переполнении результат - BigInt
+func AddIntegers(a, b int64) object.Object {
+	return addIntegers(a, b)
+}
+
+func SubIntegers(a, b int64) object.Object {
+	return subIntegers(a, b)
+}
+
+func MulIntegers(a, b int64) object.Object {
+	return mulIntegers(a, b)
+}
+
+func EvalPrefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func EvalIndex(left object.Object, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// SetIndex возвращает копию container, в которой элемент по пути indices заменен на value,
+// или сам container, измененный на месте, если inPlace
+func SetIndex(container object.Object, indices []object.Object, value object.Object, inPlace bool) object.Object {
+	return setIndex(container, indices, value, inPlace)
+}
+
+// UpdateIndex выполняет container[indices] op= value и возвращает новое значение элемента и копию container
+// (или сам container, измененный на месте, если inPlace)
+func UpdateIndex(container object.Object, indices []object.Object, operator string, value object.Object, inPlace bool) (object.Object, object.Object) {
+	return updateIndex(container, indices, operator, value, inPlace)
+}
+
+// UnpackArray и UnpackHash возвращают значения для образцов деструктуризации [a, b] и {key: a}
+func UnpackArray(value object.Object, n int) ([]object.Object, *object.Error) {
+	return unpackArray(value, n)
+}
+
+func UnpackHash(value object.Object, keys []object.Object) ([]object.Object, *object.Error) {
+	return unpackHash(value, keys)
+}
+
+// EvalSelector возвращает переменную name модуля left
+func EvalSelector(left object.Object, name string) object.Object {
+	return evalSelectorExpression(left, name)
+}
+
+// Import загружает модуль для инструкции import в файле from через окружение env
+func Import(ctx context.Context, env *object.Context, path string, from string) object.Object {
+	return importModule(ctx, env, path, from)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// Catchable сообщает, что ошибку можно поймать в catch: все ошибки, кроме превышения ограничений и рекурсии
+func Catchable(err *object.Error) bool {
+	return catchable(err)
+}
+
+// CaughtError возвращает значение переменной catch для пойманной ошибки
+func CaughtError(err *object.Error) object.Object {
+	return caughtError(err)
+}
+
+// ThrownError создает ошибку из значения, переданного в throw
+func ThrownError(value object.Object) *object.Error {
+	return thrownError(value)
+}
+
+// LookupBuiltin возвращает встроенную функцию по имени
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
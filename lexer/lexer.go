@@ -2,24 +2,36 @@ package lexer
 
 /*
 	Осуществляет разбор входного текста на токены
-	Лексер структура с методом NextToken() возвращающий следующий токен из входного текста
+	Лексер структура с методом NextToken() возвращающий следующий токен из входного текста.
+	Строчные и блочные комментарии не являются токенами, а сохраняются в поле Comments следующего за ними токена
 */
 
 import (
 	"mlang/token"
+	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
+	file         string
 	position     int
 	readPosition int
 	ch           byte
+	row          int
+	col          int
 	lastToken    token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input, lastToken: newToken(token.SEMICOLON, 0)}
+	return NewFile("", input)
+}
+
+// NewFile создает лексер для текста из файла file, имя файла попадает в позиции токенов
+func NewFile(file string, input string) *Lexer {
+	l := &Lexer{input: input, file: file, row: 1, lastToken: newToken(token.SEMICOLON, 0)}
 	l.readChar()
 	return l
 }
@@ -32,39 +44,131 @@ func (l *Lexer) peekChar() byte {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.row++
+		l.col = 0
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
 		l.ch = l.input[l.readPosition]
 	}
+	if utf8.RuneStart(l.ch) {
+		l.col++
+	}
 	l.position = l.readPosition
 	l.readPosition++
 }
 
+func (l *Lexer) pos() token.TokenPosition {
+	return token.TokenPosition{File: l.file, Row: l.row, Col: l.col, Offset: l.position}
+}
+
 func (l *Lexer) NextToken() token.Token {
+	comments, tok, ok := l.readComments()
+	if !ok {
+		tok = l.readToken()
+	}
+	tok.Comments = comments
+	l.lastToken = tok
+	return tok
+}
+
+// readComments пропускает пробелы и читает комментарии перед следующим токеном. Если комментарий
+// сам становится токеном, он возвращается с ok: многострочный блочный комментарий там, где перевод строки
+// завершает инструкцию, - это SEMICOLON, незакрытый блочный комментарий - ILLEGAL
+func (l *Lexer) readComments() (comments []token.Comment, tok token.Token, ok bool) {
+	for {
+		l.skipWhitespace()
+		if !isCommentStart(l.input, l.position) {
+			return comments, tok, false
+		}
+
+		comment, closed := l.readComment()
+		if !closed {
+			return comments, token.Token{Type: token.ILLEGAL, Literal: "/*", Pos: comment.Pos}, true
+		}
+		comments = append(comments, comment)
+		if comment.IsBlock() && strings.Contains(comment.Text, "\n") && !l.continuesLine() {
+			return comments, token.Token{Type: token.SEMICOLON, Literal: ";", Pos: comment.Pos}, true
+		}
+	}
+}
+
+// readComment читает комментарий, начинающийся с текущего символа. closed ложно для незакрытого /*
+func (l *Lexer) readComment() (comment token.Comment, closed bool) {
+	comment.Pos = l.pos()
+	end, closed := commentEnd(l.input, l.position)
+	comment.Text = l.input[l.position:end]
+	for l.position < end {
+		l.readChar()
+	}
+	return comment, closed
+}
+
+func isCommentStart(input string, pos int) bool {
+	return pos+1 < len(input) && input[pos] == '/' && (input[pos+1] == '/' || input[pos+1] == '*')
+}
+
+// commentEnd возвращает смещение конца комментария, начинающегося в start. Строчный комментарий
+// заканчивается перед переводом строки, блочные комментарии могут быть вложенными: /* a /* b */ c */
+func commentEnd(input string, start int) (int, bool) {
+	if input[start+1] == '/' {
+		if end := strings.IndexByte(input[start:], '\n'); end >= 0 {
+			return start + end, true
+		}
+		return len(input), true
+	}
+
+	depth := 0
+	for i := start; i+1 < len(input); {
+		switch {
+		case input[i] == '/' && input[i+1] == '*':
+			depth++
+			i += 2
+		case input[i] == '*' && input[i+1] == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i, true
+			}
+		default:
+			i++
+		}
+	}
+	return len(input), false
+}
+
+// readToken читает токен, начинающийся с текущего символа
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := l.pos()
 
 	switch l.ch {
 	case '\n':
 		tok = newToken(token.SEMICOLON, ';')
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			tok = token.Token{Type: token.EQUAL, Literal: string(ch) + string(l.ch)}
+			tok = l.readTwoCharToken(token.EQUAL)
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.readOperator(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.readOperator(token.MINUS, token.MINUS_ASSIGN)
 	case '/':
-		tok = newToken(token.DIV, l.ch)
+		tok = l.readOperator(token.DIV, token.DIV_ASSIGN)
 	case '*':
-		tok = newToken(token.MUL, l.ch)
+		if l.peekChar() == '*' {
+			tok = l.readTwoCharToken(token.POWER)
+		} else {
+			tok = l.readOperator(token.MUL, token.MUL_ASSIGN)
+		}
+	case '%':
+		tok = l.readOperator(token.MOD, token.MOD_ASSIGN)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -73,40 +177,68 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.LT_EQUAL)
+		case '<':
+			tok = l.readTwoCharToken(token.SHIFT_LEFT)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.GT_EQUAL)
+		case '>':
+			tok = l.readTwoCharToken(token.SHIFT_RIGHT)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			tok = token.Token{Type: token.NOT_EQUAL, Literal: string(ch) + string(l.ch)}
+			tok = l.readTwoCharToken(token.NOT_EQUAL)
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '&':
 		if l.peekChar() == '&' {
-			ch := l.ch
-			l.readChar()
-			tok = token.Token{Type: token.DOUBLE_AMPERSAND, Literal: string(ch) + string(l.ch)}
+			tok = l.readTwoCharToken(token.DOUBLE_AMPERSAND)
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = newToken(token.AMPERSAND, l.ch)
 		}
 	case '|':
 		if l.peekChar() == '|' {
-			ch := l.ch
-			l.readChar()
-			tok = token.Token{Type: token.DOUBLE_PIPE, Literal: string(ch) + string(l.ch)}
+			tok = l.readTwoCharToken(token.DOUBLE_PIPE)
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = newToken(token.PIPE, l.ch)
 		}
 	case '^':
 		tok = newToken(token.CARET, l.ch)
+	case '~':
+		if l.peekChar() == '/' {
+			tok = l.readTwoCharToken(token.INT_DIV)
+		} else {
+			tok = newToken(token.TILDE, l.ch)
+		}
+	case '"':
+		tok = l.readString()
+		if tok.Type == token.ILLEGAL {
+			l.readChar()
+			return tok
+		}
 	case 0:
 		tok.Literal = "EOF"
 		tok.Type = token.EOF
@@ -114,50 +246,202 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
-			l.lastToken = tok
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			var ok bool
-			tok.Literal, ok = l.readNumber()
-			if ok {
-				tok.Type = token.INT
-			} else {
-				tok.Type = token.ILLEGAL
-			}
-			l.lastToken = tok
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		}
 		tok = newToken(token.ILLEGAL, l.ch)
 	}
 
 	l.readChar()
-	l.lastToken = tok
+	tok.Pos = pos
 	return tok
 }
 
+// readTwoCharToken читает оператор из текущего и следующего символов
+func (l *Lexer) readTwoCharToken(t token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: t, Literal: string(ch) + string(l.ch)}
+}
+
+// readOperator читает арифметический оператор или составное присваивание, если за ним следует =
+func (l *Lexer) readOperator(t, assign token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		return l.readTwoCharToken(assign)
+	}
+	return newToken(t, l.ch)
+}
+
+// Clone возвращает независимую копию лексера для просмотра токенов вперед
+func (l *Lexer) Clone() *Lexer {
+	clone := *l
+	return &clone
+}
+
 func (l *Lexer) skipWhitespace() {
-	for unicode.IsSpace(rune(l.ch)) && (l.ch != '\n' || l.lastToken.Type == token.SEMICOLON || l.lastToken.Type == token.LBRACE) {
+	for unicode.IsSpace(rune(l.ch)) && (l.ch != '\n' || l.continuesLine()) {
 		l.readChar()
 	}
 }
 
+// continuesLine сообщает, что перевод строки не завершает выражение:
+// после разделителей и открывающих скобок, а также перед закрывающими ) и ], в том числе через комментарии
+func (l *Lexer) continuesLine() bool {
+	switch l.lastToken.Type {
+	case token.SEMICOLON, token.LBRACE, token.COMMA, token.LPAREN, token.LBRACKET:
+		return true
+	}
+
+	pos := l.position
+	for pos < len(l.input) {
+		if unicode.IsSpace(rune(l.input[pos])) {
+			pos++
+		} else if isCommentStart(l.input, pos) {
+			pos, _ = commentEnd(l.input, pos)
+		} else {
+			break
+		}
+	}
+	return pos < len(l.input) && (l.input[pos] == ')' || l.input[pos] == ']')
+}
+
 func isDigit(ch byte) bool {
 	return unicode.IsDigit(rune(ch))
 }
 
-func (l *Lexer) readNumber() (string, bool) {
+// readNumber читает целое число или число с плавающей точкой: 3.14, 1e-9, 2.5E+3.
+// Точка без цифр после нее не входит в число, чтобы 1.f читалось как обращение к f
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
-	for isDigit(l.ch) {
+	var tokenType token.TokenType = token.INT
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if (l.ch == 'e' || l.ch == 'E') && l.isExponent() {
+		tokenType = token.FLOAT
 		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readDigits()
 	}
 
-	ok := true
 	for isLetter(l.ch) {
 		l.readChar()
-		ok = false
+		tokenType = token.ILLEGAL
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) {
+		l.readChar()
+	}
+}
+
+// isExponent проверяет, что за текущим символом e следует порядок числа: цифры со знаком или без
+func (l *Lexer) isExponent() bool {
+	next := l.readPosition
+	if next < len(l.input) && (l.input[next] == '+' || l.input[next] == '-') {
+		next++
+	}
+	return next < len(l.input) && isDigit(l.input[next])
+}
+
+// readString читает строку в кавычках. Для незакрытой строки возвращается ILLEGAL с текстом
+// от открывающей кавычки до конца строки исходного текста, для некорректной escape-последовательности -
+// ILLEGAL с позицией и текстом этой последовательности, строка при этом дочитывается до закрывающей кавычки
+func (l *Lexer) readString() token.Token {
+	start := l.position
+	pos := l.pos()
+	var out strings.Builder
+	var bad *token.Token
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			if bad != nil {
+				return *bad
+			}
+			return token.Token{Type: token.STRING, Literal: out.String(), Pos: pos}
+		case 0:
+			return l.unterminatedString(start, pos)
+		case '\\':
+			escape := token.Token{Type: token.ILLEGAL, Pos: l.pos()}
+			escapeStart := l.position
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case '"':
+				out.WriteByte('"')
+			case '\\':
+				out.WriteByte('\\')
+			case 'u':
+				r, valid := l.readUnicodeEscape()
+				if valid {
+					out.WriteRune(r)
+				} else if bad == nil {
+					escape.Literal = escapeLiteral(l.input, escapeStart, 6)
+					bad = &escape
+				}
+			case 0:
+				return l.unterminatedString(start, pos)
+			default:
+				if bad == nil {
+					escape.Literal = escapeLiteral(l.input, escapeStart, 2)
+					bad = &escape
+				}
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
+// unterminatedString возвращает ILLEGAL для строки без закрывающей кавычки, начинающейся в start
+func (l *Lexer) unterminatedString(start int, pos token.TokenPosition) token.Token {
+	literal := l.input[start:]
+	if end := strings.IndexByte(literal, '\n'); end >= 0 {
+		literal = literal[:end]
+	}
+	return token.Token{Type: token.ILLEGAL, Literal: literal, Pos: pos}
+}
+
+// escapeLiteral возвращает текст escape-последовательности длиной не больше n байт,
+// не захватывая закрывающую кавычку и перевод строки
+func escapeLiteral(input string, start int, n int) string {
+	end := start + 1
+	for end < len(input) && end < start+n && input[end] != '"' && input[end] != '\n' {
+		end++
 	}
+	return input[start:end]
+}
 
-	return l.input[position:l.position], ok
+// readUnicodeEscape читает 4 шестнадцатеричные цифры после \u
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	if l.readPosition+4 > len(l.input) {
+		return unicode.ReplacementChar, false
+	}
+	code, err := strconv.ParseUint(l.input[l.readPosition:l.readPosition+4], 16, 32)
+	if err != nil {
+		return unicode.ReplacementChar, false
+	}
+	for i := 0; i < 4; i++ {
+		l.readChar()
+	}
+	return rune(code), true
 }
 
 func (l *Lexer) readIdentifier() string {
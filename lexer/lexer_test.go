@@ -1,13 +1,14 @@
 package lexer
 
 import (
+	"reflect"
 	"testing"
 
 	"mlang/token"
 )
 
 func TestNextTokenSimple(t *testing.T) {
-	input := `=+(){},-/*<>! == !=&&||^;`
+	input := `=+(){},-/ *<>! == !=&&||^[].;`
 
 	expected := []struct {
 		expectedType    token.TokenType
@@ -31,6 +32,9 @@ func TestNextTokenSimple(t *testing.T) {
 		{token.DOUBLE_AMPERSAND, "&&"},
 		{token.DOUBLE_PIPE, "||"},
 		{token.CARET, "^"},
+		{token.LBRACKET, "["},
+		{token.RBRACKET, "]"},
+		{token.DOT, "."},
 		{token.SEMICOLON, ";"},
 		{token.EOF, "EOF"},
 	}
@@ -52,6 +56,128 @@ func TestNextTokenSimple(t *testing.T) {
 	}
 }
 
+func TestNextTokenOperators(t *testing.T) {
+	input := `a <= b >= c % d ** e ~/ f & g | h << i >> j ~k < -l`
+
+	expected := []token.TokenType{
+		token.IDENT, token.LT_EQUAL, token.IDENT, token.GT_EQUAL, token.IDENT, token.MOD, token.IDENT,
+		token.POWER, token.IDENT, token.INT_DIV, token.IDENT, token.AMPERSAND, token.IDENT, token.PIPE,
+		token.IDENT, token.SHIFT_LEFT, token.IDENT, token.SHIFT_RIGHT, token.IDENT, token.TILDE, token.IDENT,
+		token.LT, token.MINUS, token.IDENT, token.EOF,
+	}
+
+	l := New(input)
+	for i, tokenType := range expected {
+		tok := l.NextToken()
+		if tok.Type != tokenType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got %q (%q)", i, tokenType, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenAssignOperators(t *testing.T) {
+	input := `a += 1; b -= 2; c *= 3; d /= 4; e %= 5; f **= 6`
+
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "a"}, {Type: token.PLUS_ASSIGN, Literal: "+="}, {Type: token.INT, Literal: "1"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.IDENT, Literal: "b"}, {Type: token.MINUS_ASSIGN, Literal: "-="}, {Type: token.INT, Literal: "2"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.IDENT, Literal: "c"}, {Type: token.MUL_ASSIGN, Literal: "*="}, {Type: token.INT, Literal: "3"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.IDENT, Literal: "d"}, {Type: token.DIV_ASSIGN, Literal: "/="}, {Type: token.INT, Literal: "4"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.IDENT, Literal: "e"}, {Type: token.MOD_ASSIGN, Literal: "%="}, {Type: token.INT, Literal: "5"},
+		{Type: token.SEMICOLON, Literal: ";"},
+		{Type: token.IDENT, Literal: "f"}, {Type: token.POWER, Literal: "**"}, {Type: token.ASSIGN, Literal: "="},
+		{Type: token.INT, Literal: "6"}, {Type: token.EOF, Literal: "EOF"},
+	}
+
+	l := New(input)
+	for i, expectedToken := range expected {
+		tok := l.NextToken()
+		if tok.Type != expectedToken.Type || tok.Literal != expectedToken.Literal {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got %q %q",
+				i, expectedToken.Type, expectedToken.Literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+x = 1 // one
+/* block /* nested */ comment */ y = 2 /* multi
+line */ z = 3
+f(a, // first
+  b
+  // last
+)
+// tail`
+
+	expected := []struct {
+		tokenType token.TokenType
+		literal   string
+		comments  []string
+	}{
+		{token.IDENT, "x", []string{"// header"}},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "1", nil},
+		{token.SEMICOLON, ";", []string{"// one"}},
+		{token.IDENT, "y", []string{"/* block /* nested */ comment */"}},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "2", nil},
+		{token.SEMICOLON, ";", []string{"/* multi\nline */"}},
+		{token.IDENT, "z", nil},
+		{token.ASSIGN, "=", nil},
+		{token.INT, "3", nil},
+		{token.SEMICOLON, ";", nil},
+		{token.IDENT, "f", nil},
+		{token.LPAREN, "(", nil},
+		{token.IDENT, "a", nil},
+		{token.COMMA, ",", nil},
+		{token.IDENT, "b", []string{"// first"}},
+		{token.RPAREN, ")", []string{"// last"}},
+		{token.SEMICOLON, ";", nil},
+		{token.EOF, "EOF", []string{"// tail"}},
+	}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.tokenType || tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q", i, tt.tokenType, tt.literal, tok.Type, tok.Literal)
+		}
+		var comments []string
+		for _, c := range tok.Comments {
+			comments = append(comments, c.Text)
+		}
+		if !reflect.DeepEqual(comments, tt.comments) {
+			t.Errorf("tests[%d] - comments wrong. expected=%q, got=%q", i, tt.comments, comments)
+		}
+	}
+}
+
+func TestCommentPosition(t *testing.T) {
+	l := New("x /* a\n b */ + 1")
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.SEMICOLON || len(tok.Comments) != 1 {
+		t.Fatalf("multiline comment should end statement, got %s with %d comments", tok.Type, len(tok.Comments))
+	}
+	if pos := tok.Comments[0].Pos; pos.Row != 1 || pos.Col != 3 {
+		t.Errorf("comment position should be 1:3, got %s", pos)
+	}
+	if !tok.Comments[0].IsBlock() {
+		t.Errorf("comment should be block")
+	}
+
+	l = New("x /* a /* b */")
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.ILLEGAL || tok.Literal != "/*" {
+		t.Errorf("unterminated comment should be ILLEGAL /*, got %s %q", tok.Type, tok.Literal)
+	}
+}
+
 func TestNextToken(t *testing.T) {
 	input := `five = 5
 	ten = 10
@@ -187,3 +313,164 @@ func TestNextTokenMultiline(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTokenNumber(t *testing.T) {
+	input := `42 3.14 1e-9 2.5E+3 1.f 1e 7x 0.5.5`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "42"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.IDENT, "f"},
+		{token.ILLEGAL, "1e"},
+		{token.ILLEGAL, "7x"},
+		{token.FLOAT, "0.5"},
+		{token.DOT, "."},
+		{token.INT, "5"},
+		{token.EOF, "EOF"},
+	}
+
+	l := New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got %q %q",
+				i, tt.expectedType, tok.Type, tok.Literal)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenString(t *testing.T) {
+	input := `"foobar" "foo bar" "a\nb\t\"c\"\\" "Ж" "\u0416" "bad\q" "x\u12" "\u00zz!" "unterminated
+next line`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{token.STRING, "foobar", "1:1"},
+		{token.STRING, "foo bar", "1:10"},
+		{token.STRING, "a\nb\t\"c\"\\", "1:20"},
+		{token.STRING, "Ж", "1:36"},
+		{token.STRING, "Ж", "1:40"},
+		{token.ILLEGAL, `\q`, "1:53"},
+		{token.ILLEGAL, `\u12`, "1:59"},
+		{token.ILLEGAL, `\u00zz`, "1:66"},
+		{token.ILLEGAL, `"unterminated`, "1:75"},
+		{token.EOF, "EOF", ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got %q %q",
+				i, tt.expectedType, tok.Type, tok.Literal)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tt.expectedPos != "" && tok.Pos.String() != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestNextTokenMultilineList(t *testing.T) {
+	input := `arr = [
+		1,
+		2
+	]
+	f(arr,
+		3
+	)
+	`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "arr"},
+		{token.ASSIGN, "="},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.IDENT, "arr"},
+		{token.COMMA, ","},
+		{token.INT, "3"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, "EOF"},
+	}
+
+	l := New(input)
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got %q %q",
+				i, tt.expectedType, tok.Type, tok.Literal)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenPosition(t *testing.T) {
+	input := `x = 10
+	s = "Жук" + y
+`
+
+	expected := []token.TokenPosition{
+		{File: "a.mlang", Row: 1, Col: 1, Offset: 0},
+		{File: "a.mlang", Row: 1, Col: 3, Offset: 2},
+		{File: "a.mlang", Row: 1, Col: 5, Offset: 4},
+		{File: "a.mlang", Row: 1, Col: 7, Offset: 6},
+		{File: "a.mlang", Row: 2, Col: 2, Offset: 8},
+		{File: "a.mlang", Row: 2, Col: 4, Offset: 10},
+		{File: "a.mlang", Row: 2, Col: 6, Offset: 12},
+		{File: "a.mlang", Row: 2, Col: 12, Offset: 21},
+		{File: "a.mlang", Row: 2, Col: 14, Offset: 23},
+		{File: "a.mlang", Row: 2, Col: 15, Offset: 24},
+		{File: "a.mlang", Row: 3, Col: 1, Offset: 25},
+	}
+
+	l := NewFile("a.mlang", input)
+
+	for i, pos := range expected {
+		tok := l.NextToken()
+
+		if tok.Pos != pos {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%v, got=%v",
+				i, tok.Literal, pos, tok.Pos)
+		}
+	}
+}
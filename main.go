@@ -1,13 +1,20 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"mlang/repl"
 	"os"
 	"os/user"
+	"path/filepath"
 )
 
 func main() {
+	engine := flag.String("engine", repl.ENGINE_EVAL, "execution engine: eval (tree-walking evaluator) or vm (bytecode virtual machine)")
+	path := flag.String("path", "", "list of directories to search for imported modules, separated by "+string(filepath.ListSeparator))
+	flag.Parse()
+	args := flag.Args()
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -16,16 +23,16 @@ func main() {
 	in := os.Stdin
 	out := os.Stdout
 	interactive := true
-	if len(os.Args) > 1 {
-		in, err = os.Open(os.Args[1])
+	if len(args) > 0 {
+		in, err = os.Open(args[0])
 		if err != nil {
-			fmt.Printf("Can not open file %s", os.Args[1])
+			fmt.Printf("Can not open file %s", args[0])
 			return
 		}
-		if len(os.Args) > 2 {
-			out, err = os.Create(os.Args[2])
+		if len(args) > 1 {
+			out, err = os.Create(args[1])
 			if err != nil {
-				fmt.Printf("Can not open file %s", os.Args[1])
+				fmt.Printf("Can not open file %s", args[1])
 				return
 			}
 		}
@@ -35,5 +42,9 @@ func main() {
 		fmt.Printf("Hello %s! This is the MLang programming language!\n", user.Username)
 		fmt.Printf("Feel free to type in commands\n")
 	}
-	repl.Start(in, out, interactive)
+	opts := repl.Options{Engine: *engine, Stdin: os.Stdin, Stderr: os.Stderr, Path: filepath.SplitList(*path)}
+	if err := repl.Start(in, out, interactive, opts); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,423 @@
+package mlang
+
+import (
+	"fmt"
+	"math/big"
+	"mlang/evaluator"
+	"mlang/object"
+	"reflect"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// caller вызывает функцию языка. Встроенные функции вызывают функции программы через
+// object.Context.Call, в том же потоке выполнения и с теми же ограничениями, что и программа
+type caller func(fn object.Object, args []object.Object) object.Object
+
+// toObject преобразует значение Go в объект языка
+func (in *Interpreter) toObject(value interface{}) (object.Object, error) {
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+	return in.valueToObject(reflect.ValueOf(value))
+}
+
+func (in *Interpreter) valueToObject(v reflect.Value) (object.Object, error) {
+	return in.convertValue(v, make(map[visit]bool))
+}
+
+// visit срез, словарь или указатель, которые преобразуются в данный момент. Повторная встреча
+// с ним внутри его же элементов означает, что значение ссылается само на себя
+type visit struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// convertValue преобразует значение Go, path содержит ссылки, внутри которых находится v
+func (in *Interpreter) convertValue(v reflect.Value, path map[visit]bool) (object.Object, error) {
+	if !v.IsValid() {
+		return evaluator.NULL, nil
+	}
+	if v.Type().Implements(objectType) && v.Kind() != reflect.Interface {
+		return v.Interface().(object.Object), nil
+	}
+	if v.Type() == bigIntType && !v.IsNil() {
+		return object.IntegerFromBig(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Ptr:
+		if !v.IsNil() {
+			key := visit{typ: v.Type(), ptr: v.Pointer()}
+			if v.Kind() == reflect.Slice {
+				key.len = v.Len()
+			}
+			if path[key] {
+				return nil, fmt.Errorf("value of type %s refers to itself", v.Type())
+			}
+			path[key] = true
+			defer delete(path, key)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("integer overflow: %d", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := in.convertValue(v.Index(i), path)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		hash := object.NewHash()
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := in.convertValue(iter.Key(), path)
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := in.convertValue(iter.Value(), path)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(hashable, value)
+		}
+		return hash, nil
+	case reflect.Func:
+		return in.builtin(v.Interface())
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return in.convertValue(v.Elem(), path)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
+
+// fromObject преобразует объект языка в значение Go: integer в int64 или *big.Int, float в float64, array в []interface{},
+// hash в map[interface{}]interface{}, функции в func(...interface{}) (interface{}, error).
+// Задачи и каналы возвращаются как есть, а ошибка выполнения - как error
+func (in *Interpreter) fromObject(obj object.Object, call caller) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Error:
+		return nil, obj
+	case *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInt:
+		return new(big.Int).Set(obj.Value), nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := in.fromObject(el, call)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *object.Hash:
+		hash := make(map[interface{}]interface{}, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, err := in.fromObject(pair.Key, call)
+			if err != nil {
+				return nil, err
+			}
+			value, err := in.fromObject(pair.Value, call)
+			if err != nil {
+				return nil, err
+			}
+			hash[key] = value
+		}
+		return hash, nil
+	case *object.Function, *object.Builtin:
+		return func(args ...interface{}) (interface{}, error) {
+			return in.call(call, obj, args)
+		}, nil
+	default:
+		return obj, nil
+	}
+}
+
+// toValue преобразует объект языка в значение Go типа t
+func (in *Interpreter) toValue(obj object.Object, t reflect.Type, call caller) (reflect.Value, error) {
+	if t.Kind() == reflect.Interface {
+		if reflect.TypeOf(obj).Implements(t) && t.NumMethod() > 0 {
+			return reflect.ValueOf(obj), nil
+		}
+		value, err := in.fromObject(obj, call)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if value == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(value), nil
+	}
+
+	mismatch := fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+	if b, ok := obj.(*object.BigInt); ok {
+		switch {
+		case t == bigIntType:
+			return reflect.ValueOf(new(big.Int).Set(b.Value)), nil
+		case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+			f, _ := new(big.Float).SetInt(b.Value).Float64()
+			return reflect.ValueOf(f).Convert(t), nil
+		case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uintptr:
+			return reflect.Value{}, fmt.Errorf("integer overflow: %s does not fit %s", b.Value, t)
+		default:
+			return reflect.Value{}, mismatch
+		}
+	}
+	if i, ok := obj.(*object.Integer); ok && t == bigIntType {
+		return reflect.ValueOf(big.NewInt(i.Value)), nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(b.Value).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return reflect.Value{}, mismatch
+		}
+		value := reflect.New(t).Elem()
+		if value.OverflowInt(i.Value) {
+			return reflect.Value{}, fmt.Errorf("integer overflow: %d does not fit %s", i.Value, t)
+		}
+		value.SetInt(i.Value)
+		return value, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return reflect.Value{}, mismatch
+		}
+		value := reflect.New(t).Elem()
+		if i.Value < 0 || value.OverflowUint(uint64(i.Value)) {
+			return reflect.Value{}, fmt.Errorf("integer overflow: %d does not fit %s", i.Value, t)
+		}
+		value.SetUint(uint64(i.Value))
+		return value, nil
+	case reflect.Float32, reflect.Float64:
+		// целые числа подходят и для параметров с плавающей точкой
+		var f float64
+		switch obj := obj.(type) {
+		case *object.Float:
+			f = obj.Value
+		case *object.Integer:
+			f = float64(obj.Value)
+		default:
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(f).Convert(t), nil
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(s.Value).Convert(t), nil
+	case reflect.Slice:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return reflect.Value{}, mismatch
+		}
+		slice := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		for i, el := range arr.Elements {
+			value, err := in.toValue(el, t.Elem(), call)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice.Index(i).Set(value)
+		}
+		return slice, nil
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return reflect.Value{}, mismatch
+		}
+		m := reflect.MakeMapWithSize(t, hash.Len())
+		for _, pair := range hash.Pairs() {
+			key, err := in.toValue(pair.Key, t.Key(), call)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := in.toValue(pair.Value, t.Elem(), call)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(key, value)
+		}
+		return m, nil
+	case reflect.Func:
+		switch obj.(type) {
+		case *object.Function, *object.Builtin:
+		default:
+			return reflect.Value{}, mismatch
+		}
+		return in.goFunc(obj, t, call), nil
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// builtin оборачивает функцию Go во встроенную функцию языка
+func (in *Interpreter) builtin(fn interface{}) (*object.Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("builtin should be a function, got %T", fn)
+	}
+	t := v.Type()
+	if t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return nil, fmt.Errorf("builtin should return a value, an error or both, got %s", t)
+	}
+
+	return &object.Builtin{Fn: func(ctx *object.Context, args ...object.Object) (result object.Object) {
+		defer func() {
+			if x := recover(); x != nil {
+				if err, ok := x.(*object.Error); ok {
+					result = err
+					return
+				}
+				result = &object.Error{Message: fmt.Sprintf("builtin panicked: %v", x)}
+			}
+		}()
+
+		params := t.NumIn()
+		if t.IsVariadic() {
+			params--
+			if len(args) < params {
+				return &object.Error{Message: fmt.Sprintf("function expects at least %d arguments, %d was given", params, len(args))}
+			}
+		} else if len(args) != params {
+			return &object.Error{Message: fmt.Sprintf("function expects %d arguments, %d was given", params, len(args))}
+		}
+
+		values := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i < params {
+				paramType = t.In(i)
+			} else {
+				paramType = t.In(params).Elem()
+			}
+			value, err := in.toValue(arg, paramType, ctx.Call)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("argument %d: %s", i, err)}
+			}
+			values[i] = value
+		}
+
+		return in.results(v.Call(values))
+	}}, nil
+}
+
+// results преобразует результаты функции Go в объект языка
+func (in *Interpreter) results(out []reflect.Value) object.Object {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			if obj, ok := err.(*object.Error); ok {
+				return obj
+			}
+			return &object.Error{Message: err.Error(), Err: err}
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return evaluator.NULL
+	}
+
+	obj, err := in.valueToObject(out[0])
+	if err != nil {
+		return &object.Error{Message: err.Error(), Err: err}
+	}
+	return obj
+}
+
+// goFunc создает функцию Go типа t, вызывающую функцию языка через call. Если у t нет результата типа error,
+// ошибка вызова приводит к панике
+func (in *Interpreter) goFunc(fn object.Object, t reflect.Type, call caller) reflect.Value {
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		fail := func(err error) []reflect.Value {
+			if len(out) == 0 || t.Out(len(out)-1) != errorType {
+				panic(err)
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		objects := make([]object.Object, 0, len(args))
+		for i, arg := range args {
+			if t.IsVariadic() && i == len(args)-1 {
+				for j := 0; j < arg.Len(); j++ {
+					obj, err := in.valueToObject(arg.Index(j))
+					if err != nil {
+						return fail(err)
+					}
+					objects = append(objects, obj)
+				}
+				continue
+			}
+			obj, err := in.valueToObject(arg)
+			if err != nil {
+				return fail(err)
+			}
+			objects = append(objects, obj)
+		}
+
+		result := call(fn, objects)
+		if err, ok := result.(*object.Error); ok {
+			return fail(err)
+		}
+		if len(out) > 0 && t.Out(0) != errorType {
+			value, err := in.toValue(result, t.Out(0), call)
+			if err != nil {
+				return fail(err)
+			}
+			out[0] = value
+		}
+		return out
+	})
+}
@@ -0,0 +1,196 @@
+package mlang
+
+/*
+	Модуль для встраивания интерпретатора в программы на Go. Interpreter хранит глобальные переменные
+	между вызовами Eval, а значения Go автоматически преобразуются в объекты языка и обратно:
+	целые числа - в integer, числа с плавающей точкой - в float, bool - в boolean, string - в string,
+	срезы и массивы - в array, словари - в hash, функции - во встроенные функции языка.
+	Interpreter не предназначен для одновременного использования из нескольких горутин
+*/
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mlang/ast"
+	"mlang/evaluator"
+	"mlang/lexer"
+	"mlang/modules"
+	"mlang/object"
+	"mlang/parser"
+	"mlang/resolver"
+	"os"
+	"strings"
+)
+
+// Options настройки интерпретатора
+type Options struct {
+	Limits evaluator.Limits // ограничения каждого вызова Eval и Call
+	Stdin  io.Reader        // ввод функций read, по умолчанию os.Stdin
+	Stdout io.Writer        // вывод функции print, по умолчанию os.Stdout
+	Stderr io.Writer        // по умолчанию os.Stderr
+	Path   []string         // каталоги поиска модулей для import, кроме текущего
+}
+
+type Interpreter struct {
+	env         *object.Environment
+	interpreter *evaluator.Interpreter
+}
+
+func New(opts Options) *Interpreter {
+	env := object.NewEnvironment()
+	interpreter := evaluator.NewInterpreter(env, opts.Limits)
+	if opts.Stdin != nil || opts.Stdout != nil || opts.Stderr != nil {
+		var in io.Reader = os.Stdin
+		var out, err io.Writer = os.Stdout, os.Stderr
+		if opts.Stdin != nil {
+			in = opts.Stdin
+		}
+		if opts.Stdout != nil {
+			out = opts.Stdout
+		}
+		if opts.Stderr != nil {
+			err = opts.Stderr
+		}
+		interpreter.Context = object.NewContext(in, out, err)
+	}
+	loader := modules.New(opts.Path, func(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error {
+		module := evaluator.NewInterpreter(globals, opts.Limits)
+		module.Context = env
+		results := module.Run(ctx, program)
+		if len(results) == 0 {
+			return nil
+		}
+		err, _ := results[len(results)-1].(*object.Error)
+		return err
+	})
+	interpreter.Context = loader.Context(interpreter.Context, "")
+	return &Interpreter{env: env, interpreter: interpreter}
+}
+
+// SyntaxError ошибки разбора и разрешения имен программы, найденные до ее выполнения
+type SyntaxError struct {
+	Errors []*parser.Error
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Eval выполняет программу и возвращает значение последней инструкции, преобразованное в значение Go.
+// Ошибка выполнения возвращается как *object.Error, ошибки в тексте программы - как *SyntaxError
+func (in *Interpreter) Eval(ctx context.Context, src string) (_ interface{}, err error) {
+	defer recoverPanic(&err)
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errors := p.Diagnostics(); len(errors) != 0 {
+		return nil, &SyntaxError{Errors: errors}
+	}
+	if errors := resolver.Resolve(program, in.env); len(errors) != 0 {
+		return nil, &SyntaxError{Errors: errors}
+	}
+
+	results := in.interpreter.Run(ctx, program)
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return in.fromObject(results[len(results)-1], in.standalone)
+}
+
+// Set присваивает значение глобальной переменной name, заводя ее при необходимости
+func (in *Interpreter) Set(name string, value interface{}) error {
+	obj, err := in.toObject(value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	in.env.Set(0, in.env.Define(name), obj)
+	return nil
+}
+
+// Get возвращает значение глобальной переменной name. Второй результат false,
+// если переменной нет или ей еще ничего не присвоено
+func (in *Interpreter) Get(name string) (interface{}, bool) {
+	slot, ok := in.env.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+	obj := in.env.Get(0, slot)
+	if obj == nil {
+		return nil, false
+	}
+	value, err := in.fromObject(obj, in.standalone)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Call вызывает функцию, записанную в глобальную переменную fnName, или встроенную функцию языка
+func (in *Interpreter) Call(fnName string, args ...interface{}) (_ interface{}, err error) {
+	defer recoverPanic(&err)
+	fn, ok := in.lookup(fnName)
+	if !ok {
+		return nil, fmt.Errorf("function not found: %s", fnName)
+	}
+	return in.call(in.standalone, fn, args)
+}
+
+// RegisterBuiltin делает функцию Go доступной в программах под именем name.
+// Аргументы функции и ее результат преобразуются так же, как в Set и Get,
+// а последний результат типа error становится ошибкой выполнения
+func (in *Interpreter) RegisterBuiltin(name string, fn interface{}) error {
+	builtin, err := in.builtin(fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	in.env.Set(0, in.env.Define(name), builtin)
+	return nil
+}
+
+// recoverPanic превращает панику встроенной функции или функции Go, вызванной программой,
+// в ошибку выполнения, чтобы она не завершала всю программу на Go
+func recoverPanic(err *error) {
+	x := recover()
+	if x == nil {
+		return
+	}
+	switch x := x.(type) {
+	case *object.Error:
+		*err = x
+	case error:
+		*err = &object.Error{Message: "panic: " + x.Error(), Err: x}
+	default:
+		*err = &object.Error{Message: fmt.Sprintf("panic: %v", x)}
+	}
+}
+
+func (in *Interpreter) lookup(name string) (object.Object, bool) {
+	if slot, ok := in.env.Lookup(name); ok {
+		if obj := in.env.Get(0, slot); obj != nil {
+			return obj, true
+		}
+	}
+	builtin, ok := evaluator.LookupBuiltin(name)
+	return builtin, ok
+}
+
+// standalone вызывает функцию языка вне выполнения программы, с собственными ограничениями
+func (in *Interpreter) standalone(fn object.Object, args []object.Object) object.Object {
+	return in.interpreter.Call(context.Background(), fn, args)
+}
+
+func (in *Interpreter) call(call caller, fn object.Object, args []interface{}) (interface{}, error) {
+	objects := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := in.toObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		objects[i] = obj
+	}
+	return in.fromObject(call(fn, objects), call)
+}
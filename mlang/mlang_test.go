@@ -0,0 +1,413 @@
+package mlang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"mlang/evaluator"
+	"mlang/object"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2", int64(3)},
+		{"1.5 * 2", 3.0},
+		{"9223372036854775807 + 1", bigInt("9223372036854775808")},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"x = 1", int64(1)},
+		{"[1, [true, null]]", []interface{}{int64(1), []interface{}{true, nil}}},
+		{`{"a": 1, 2: "b"}`, map[interface{}]interface{}{"a": int64(1), int64(2): "b"}},
+		{"", nil},
+	}
+
+	for i, tt := range tests {
+		in := New(Options{})
+		value, err := in.Eval(context.Background(), tt.input)
+		if err != nil {
+			t.Fatalf("tests[%d] error: %s", i, err)
+		}
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("tests[%d] value should be %#v, got %#v", i, tt.expected, value)
+		}
+	}
+}
+
+func bigInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
+
+func TestEvalErrors(t *testing.T) {
+	in := New(Options{Limits: evaluator.Limits{MaxSteps: 1000}})
+
+	_, err := in.Eval(context.Background(), "x = ")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("parser error should be SyntaxError, got %v", err)
+	}
+
+	_, err = in.Eval(context.Background(), "y + 1")
+	if !errors.As(err, &syntaxErr) || syntaxErr.Errors[0].Message != "identifier not found: y" {
+		t.Fatalf("undefined variable should be SyntaxError, got %v", err)
+	}
+
+	_, err = in.Eval(context.Background(), "1 + true")
+	var runtimeErr *object.Error
+	if !errors.As(err, &runtimeErr) || runtimeErr.Inspect() != "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN" {
+		t.Fatalf("runtime error should be object.Error, got %v", err)
+	}
+
+	_, err = in.Eval(context.Background(), "while (true) { 1 }")
+	if !errors.Is(err, evaluator.ErrStepLimit) {
+		t.Fatalf("error should be step limit, got %v", err)
+	}
+}
+
+func TestIO(t *testing.T) {
+	var out bytes.Buffer
+	in := New(Options{Stdin: strings.NewReader("20 22"), Stdout: &out})
+
+	value, err := in.Eval(context.Background(), "x = read() + read(); print(x); x")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if value != int64(42) {
+		t.Errorf("value should be 42, got %v", value)
+	}
+	if out.String() != "42 \n" {
+		t.Errorf("output should be %q, got %q", "42 \n", out.String())
+	}
+}
+
+func TestCanceledRead(t *testing.T) {
+	stdin, stdinWriter := io.Pipe()
+	in := New(Options{Stdin: stdin})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	_, err := in.Eval(ctx, "readLine()")
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("read should stop on deadline, got %v", err)
+	}
+
+	go fmt.Fprint(stdinWriter, "first\nsecond\n")
+	for _, want := range []string{"first", "second"} {
+		value, err := in.Eval(context.Background(), "readLine()")
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if value != want {
+			t.Errorf("value should be %q, got %v", want, value)
+		}
+	}
+}
+
+func TestCanceledReadKeepsPartialInput(t *testing.T) {
+	stdin, stdinWriter := io.Pipe()
+	in := New(Options{Stdin: stdin})
+
+	go fmt.Fprint(stdinWriter, "fir")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	_, err := in.Eval(ctx, "readLine()")
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("read should stop on deadline, got %v", err)
+	}
+
+	go fmt.Fprint(stdinWriter, "st\n")
+	value, err := in.Eval(context.Background(), "readLine()")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if value != "first" {
+		t.Errorf("value should be %q, got %v", "first", value)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "lib.mlang"), []byte("double = func(x) { x * 2 }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in := New(Options{Path: []string{dir}})
+
+	value, err := in.Eval(context.Background(), `import "lib.mlang" as lib; lib.double(21)`)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if value != int64(42) {
+		t.Errorf("value should be 42, got %v", value)
+	}
+
+	_, err = in.Eval(context.Background(), `import "missing.mlang" as m`)
+	var runtimeErr *object.Error
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.IMPORT_ERROR {
+		t.Errorf("missing module should be import error, got %v", err)
+	}
+}
+
+func TestImportLimits(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "loop.mlang"), []byte("while (true) { 1 }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	in := New(Options{Path: []string{dir}, Limits: evaluator.Limits{MaxSteps: 1000}})
+	if _, err := in.Eval(context.Background(), `import "loop.mlang" as loop`); !errors.Is(err, evaluator.ErrStepLimit) {
+		t.Errorf("module should stop on step limit, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	in = New(Options{Path: []string{dir}})
+	if _, err := in.Eval(ctx, `import "loop.mlang" as loop`); !errors.Is(err, context.Canceled) {
+		t.Errorf("module should stop on canceled context, got %v", err)
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	in := New(Options{})
+	values := map[string]interface{}{
+		"n":     42,
+		"u":     uint8(7),
+		"s":     "str",
+		"b":     true,
+		"nums":  []int{1, 2},
+		"words": [2]string{"a", "b"},
+		"m":     map[string]int{"k": 1},
+		"nil":   nil,
+	}
+	for name, value := range values {
+		if err := in.Set(name, value); err != nil {
+			t.Fatalf("Set(%s) error: %s", name, err)
+		}
+	}
+
+	result, err := in.Eval(context.Background(), `[n + u, s, b, nums[1], words[0], m["k"], nil]`)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	expected := []interface{}{int64(49), "str", true, int64(2), "a", int64(1), nil}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("result should be %#v, got %#v", expected, result)
+	}
+
+	if _, err := in.Eval(context.Background(), "n = n * 2; r = 1"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if value, ok := in.Get("n"); !ok || value != int64(84) {
+		t.Errorf("n should be 84, got %v", value)
+	}
+	if _, ok := in.Get("missing"); ok {
+		t.Errorf("missing variable should not be found")
+	}
+
+	if err := in.Set("c", make(chan int)); err == nil {
+		t.Errorf("Set of unsupported type should fail")
+	}
+	if err := in.Set("big", uint64(1<<63)); err == nil {
+		t.Errorf("Set of too big integer should fail")
+	}
+}
+
+func TestSelfReference(t *testing.T) {
+	m := map[string]interface{}{}
+	m["self"] = m
+	s := []interface{}{nil}
+	s[0] = s
+	var p interface{}
+	p = &p
+	shared := []int{1}
+
+	in := New(Options{})
+	for i, value := range []interface{}{m, s, &p} {
+		if err := in.Set("v", value); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+			t.Errorf("tests[%d] Set of self-referencing value should fail, got %v", i, err)
+		}
+		if _, err := in.Call("len", value); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+			t.Errorf("tests[%d] Call with self-referencing value should fail, got %v", i, err)
+		}
+	}
+
+	in.RegisterBuiltin("cyclic", func() interface{} { return m })
+	if _, err := in.Eval(context.Background(), "cyclic()"); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+		t.Errorf("self-referencing builtin result should fail, got %v", err)
+	}
+
+	if err := in.Set("pair", [][]int{shared, shared}); err != nil {
+		t.Errorf("value referenced twice should be converted, got %v", err)
+	}
+}
+
+func TestPanics(t *testing.T) {
+	in := New(Options{})
+	in.Set("boom", &object.Builtin{Fn: func(ctx *object.Context, args ...object.Object) object.Object {
+		panic("boom")
+	}})
+
+	if _, err := in.Eval(context.Background(), "boom()"); err == nil || !strings.Contains(err.Error(), "panic: boom") {
+		t.Errorf("Eval should return panic as error, got %v", err)
+	}
+	if _, err := in.Call("boom"); err == nil || !strings.Contains(err.Error(), "panic: boom") {
+		t.Errorf("Call should return panic as error, got %v", err)
+	}
+	if value, err := in.Eval(context.Background(), "1 + 1"); err != nil || value != int64(2) {
+		t.Errorf("interpreter should work after panic, got %v, %v", value, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	in := New(Options{})
+	if _, err := in.Eval(context.Background(), "add = func(a, b) { a + b }"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	result, err := in.Call("add", 2, 3)
+	if err != nil || result != int64(5) {
+		t.Errorf("add(2, 3) should be 5, got %v, %v", result, err)
+	}
+
+	result, err = in.Call("len", []string{"a", "b"})
+	if err != nil || result != int64(2) {
+		t.Errorf("len should be 2, got %v, %v", result, err)
+	}
+
+	if _, err := in.Call("add", 1); err == nil || !strings.Contains(err.Error(), "function expects 2 arguments") {
+		t.Errorf("call with wrong arguments should fail, got %v", err)
+	}
+	if _, err := in.Call("missing"); err == nil {
+		t.Errorf("call of missing function should fail")
+	}
+
+	add, _ := in.Get("add")
+	fn, ok := add.(func(...interface{}) (interface{}, error))
+	if !ok {
+		t.Fatalf("function should be converted to func, got %T", add)
+	}
+	if result, err := fn(10, 20); err != nil || result != int64(30) {
+		t.Errorf("fn(10, 20) should be 30, got %v, %v", result, err)
+	}
+}
+
+func TestCallbackLimits(t *testing.T) {
+	in := New(Options{Limits: evaluator.Limits{MaxSteps: 1000}})
+	in.RegisterBuiltin("apply", func(f func(int) int, x int) int { return f(x) })
+	in.RegisterBuiltin("each", func(f func(int) error, n int) error {
+		for i := 0; i < n; i++ {
+			if err := f(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	tests := []string{
+		"apply(func(x) { while (true) { x } }, 1)",
+		"try { apply(func(x) { while (true) { x } }, 1) } catch (e) { 0 }",
+		"each(func(i) { i * 2 }, 1000)",
+		"try { each(func(i) { i * 2 }, 1000) } catch (e) { 0 }",
+	}
+
+	for i, input := range tests {
+		_, err := in.Eval(context.Background(), input)
+		var runtimeErr *object.Error
+		if !errors.Is(err, evaluator.ErrStepLimit) || !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.LIMIT_ERROR {
+			t.Errorf("tests[%d] error should be step limit, got %v", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	in = New(Options{})
+	in.RegisterBuiltin("apply", func(f func(int) int, x int) int { return f(x) })
+	if _, err := in.Eval(ctx, "apply(func(x) { while (true) { x } }, 1)"); !errors.Is(err, context.Canceled) {
+		t.Errorf("callback should stop on canceled context, got %v", err)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	in := New(Options{})
+	builtins := map[string]interface{}{
+		"upper":  strings.ToUpper,
+		"sqrt":   math.Sqrt,
+		"double": func(x *big.Int) *big.Int { return x.Mul(x, big.NewInt(2)) },
+		"div": func(a, b int64) (int64, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		},
+		"join":  func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"apply": func(f func(int) int, x int) int { return f(x) },
+		"keys": func(m map[string]int) []string {
+			var keys []string
+			for k := range m {
+				keys = append(keys, k)
+			}
+			return keys
+		},
+		"noop":  func() {},
+		"panic": func() int { panic("boom") },
+	}
+	for name, fn := range builtins {
+		if err := in.RegisterBuiltin(name, fn); err != nil {
+			t.Fatalf("RegisterBuiltin(%s) error: %s", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+		err      string
+	}{
+		{`upper("abc")`, "ABC", ""},
+		{"sqrt(16)", 4.0, ""},
+		{"sqrt(2.25)", 1.5, ""},
+		{"sqrt(100000000000000000000)", 1e10, ""},
+		{"double(100000000000000000000)", bigInt("200000000000000000000"), ""},
+		{"div(100000000000000000000, 2)", nil, "ERROR: 1:4: argument 0: integer overflow: 100000000000000000000 does not fit int64"},
+		{"div(7, 2)", int64(3), ""},
+		{"div(7, 0)", nil, "ERROR: 1:4: division by zero"},
+		{`try { div(7, 0) } catch (e) { e["message"] }`, "division by zero", ""},
+		{`join("-", "a", "b", "c")`, "a-b-c", ""},
+		{"apply(func(x) { x * 10 }, 4)", int64(40), ""},
+		{`keys({"k": 1})`, []interface{}{"k"}, ""},
+		{"noop()", nil, ""},
+		{`upper(1)`, nil, "ERROR: 1:6: argument 0: cannot use INTEGER as string"},
+		{`upper("a", "b")`, nil, "ERROR: 1:6: function expects 1 arguments, 2 was given"},
+		{"panic()", nil, "ERROR: 1:6: builtin panicked: boom"},
+	}
+
+	for i, tt := range tests {
+		value, err := in.Eval(context.Background(), tt.input)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("tests[%d] error should be %q, got %v", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("tests[%d] error: %s", i, err)
+		}
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("tests[%d] value should be %#v, got %#v", i, tt.expected, value)
+		}
+	}
+
+	if err := in.RegisterBuiltin("bad", 1); err == nil {
+		t.Errorf("RegisterBuiltin of not a function should fail")
+	}
+}
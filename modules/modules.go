@@ -0,0 +1,160 @@
+package modules
+
+/*
+	Модуль загрузки файлов для инструкции import "path" as name. Каждый файл выполняется один раз
+	в собственном окружении глобальных переменных, а загруженный модуль доступен всем, кто его импортирует.
+	Путь ищется относительно каталога импортирующего файла, затем в каталогах пути поиска.
+	Циклический импорт возвращает ошибку с полной цепочкой файлов
+*/
+
+import (
+	"context"
+	"io/ioutil"
+	"mlang/ast"
+	"mlang/lexer"
+	"mlang/object"
+	"mlang/parser"
+	"mlang/resolver"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Run выполняет программу модуля в окружении globals и возвращает ошибку выполнения или nil.
+// ctx - контекст выполнения импортирующей программы, встроенные функции модуля используют окружение env
+type Run func(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error
+
+// Loader загружает модули и хранит уже загруженные по абсолютному пути файла
+type Loader struct {
+	path []string
+	run  Run
+
+	mu      sync.Mutex
+	modules map[string]*object.Task // результат - *object.Module или *object.Error
+}
+
+// New создает загрузчик с путем поиска path, модули выполняются функцией run
+func New(path []string, run Run) *Loader {
+	return &Loader{path: path, run: run, modules: make(map[string]*object.Task)}
+}
+
+// Context возвращает окружение ctx, в котором import загружает модули этим загрузчиком.
+// file - файл выполняемой программы или "" для программы не из файла
+func (l *Loader) Context(ctx *object.Context, file string) *object.Context {
+	var chain []string
+	if file != "" {
+		chain = []string{absPath(file)}
+	}
+	return l.context(ctx, chain)
+}
+
+// context возвращает окружение для файла, который загружен по цепочке импортов chain
+func (l *Loader) context(ctx *object.Context, chain []string) *object.Context {
+	return ctx.WithImport(func(run context.Context, path string, from string) object.Object {
+		return l.load(run, ctx, chain, path, from)
+	})
+}
+
+func (l *Loader) load(run context.Context, ctx *object.Context, chain []string, path string, from string) object.Object {
+	file, ok := l.find(path, from)
+	if !ok {
+		return object.NewError(object.IMPORT_ERROR, "module not found: %q", path)
+	}
+	abs := absPath(file)
+	for _, f := range chain {
+		if f == abs {
+			return importCycle(append(chain[:len(chain):len(chain)], abs))
+		}
+	}
+
+	l.mu.Lock()
+	task, loaded := l.modules[abs]
+	if !loaded {
+		task = object.NewTask()
+		l.modules[abs] = task
+	}
+	l.mu.Unlock()
+
+	if !loaded {
+		task.Resolve(l.exec(run, ctx, append(chain[:len(chain):len(chain)], abs), file))
+	}
+	result := task.Await()
+	if err, ok := result.(*object.Error); ok {
+		// ошибка получает стек вызовов того, кто импортирует модуль, поэтому у каждого своя копия
+		return err.Copy()
+	}
+	return result
+}
+
+// exec разбирает и выполняет файл модуля
+func (l *Loader) exec(run context.Context, ctx *object.Context, chain []string, file string) object.Object {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return object.NewError(object.IMPORT_ERROR, "%s", err)
+	}
+
+	p := parser.New(lexer.NewFile(file, string(src)))
+	program := p.ParseProgram()
+	globals := object.NewEnvironment()
+	errors := p.Diagnostics()
+	if len(errors) == 0 {
+		errors = resolver.Resolve(program, globals)
+	}
+	if len(errors) != 0 {
+		e := errors[0]
+		return &object.Error{Message: e.Message, Kind: object.IMPORT_ERROR, Pos: e.Pos}
+	}
+
+	if err := l.run(run, program, globals, l.context(ctx, chain)); err != nil {
+		return err
+	}
+	return &object.Module{Name: file, Env: globals}
+}
+
+// find ищет файл модуля в каталоге файла from (в текущем каталоге, если from пустой),
+// затем в каталогах пути поиска
+func (l *Loader) find(path string, from string) (string, bool) {
+	var candidates []string
+	if filepath.IsAbs(path) {
+		candidates = []string{path}
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(from), path))
+		for _, dir := range l.path {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, file := range candidates {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// importCycle возвращает ошибку с цепочкой импортов от выполняемой программы до повторного файла
+func importCycle(chain []string) *object.Error {
+	names := make([]string, len(chain))
+	for i, file := range chain {
+		names[i] = displayPath(file)
+	}
+	return object.NewError(object.IMPORT_ERROR, "import cycle: %s", strings.Join(names, " -> "))
+}
+
+func absPath(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return filepath.Clean(file)
+}
+
+// displayPath возвращает путь относительно текущего каталога, если файл находится внутри него
+func displayPath(abs string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return abs
+}
@@ -0,0 +1,169 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mlang/ast"
+	"mlang/compiler"
+	"mlang/evaluator"
+	"mlang/lexer"
+	"mlang/object"
+	"mlang/parser"
+	"mlang/resolver"
+	"mlang/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runners выполняют программы вычислителем и виртуальной машиной
+var runners = map[string]Run{
+	"eval": func(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error {
+		interpreter := evaluator.NewInterpreter(globals, evaluator.Limits{})
+		interpreter.Context = env
+		return lastError(interpreter.Run(ctx, program))
+	},
+	"vm": func(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error {
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return lastError(vm.New(c.Bytecode(), globals, env).Run())
+	},
+}
+
+func lastError(results []object.Object) *object.Error {
+	if len(results) == 0 {
+		return nil
+	}
+	err, _ := results[len(results)-1].(*object.Error)
+	return err
+}
+
+// writeFiles создает файлы во временном каталоге и возвращает его
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// runFile выполняет файл программы с загрузчиком модулей и возвращает вывод и ошибку выполнения
+func runFile(t *testing.T, run Run, path []string, file string) (string, *object.Error) {
+	t.Helper()
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.NewFile(file, string(src)))
+	program := p.ParseProgram()
+	globals := object.NewEnvironment()
+	if len(p.Diagnostics()) != 0 || len(resolver.Resolve(program, globals)) != 0 {
+		t.Fatalf("program %s has errors", file)
+	}
+
+	var out bytes.Buffer
+	loader := New(path, run)
+	ctx := loader.Context(object.NewContext(strings.NewReader(""), &out, ioutil.Discard), file)
+	runErr := run(context.Background(), program, globals, ctx)
+	return out.String(), runErr
+}
+
+func TestImport(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.mlang": `import "lib/math.mlang" as math
+			import "lib/user.mlang" as user
+			import "util.mlang" as util
+			print(math.scale(4), user.twice(1), util.greet("bob"))
+			base = 1
+			print(math.scale(4), math)`,
+		"lib/math.mlang": `print("loading math")
+			base = 10
+			scale = func(x) { x * base }`,
+		"lib/user.mlang": `import "math.mlang" as m
+			twice = func(x) { m.scale(x) * 2 }`,
+		"search/util.mlang": `greet = func(name) { "hi " + name }`,
+	})
+	main := filepath.Join(dir, "main.mlang")
+	expected := "loading math \n40 20 hi bob \n40 <module " + filepath.Join(dir, "lib/math.mlang") + "> \n"
+	for name, run := range runners {
+		out, err := runFile(t, run, []string{filepath.Join(dir, "search")}, main)
+		if err != nil {
+			t.Fatalf("%s: error: %s", name, err.Inspect())
+		}
+		if out != expected {
+			t.Errorf("%s: output should be %q, got %q", name, expected, out)
+		}
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			map[string]string{"main.mlang": `import "missing.mlang" as m`},
+			`main.mlang:1:1: module not found: "missing.mlang"`,
+		},
+		{
+			map[string]string{
+				"main.mlang": `import "a.mlang" as a`,
+				"a.mlang":    `import "b.mlang" as b`,
+				"b.mlang":    `import "a.mlang" as a`,
+			},
+			"b.mlang:1:1: import cycle: main.mlang -> a.mlang -> b.mlang -> a.mlang",
+		},
+		{
+			map[string]string{
+				"main.mlang": `import "main.mlang" as self`,
+			},
+			"main.mlang:1:1: import cycle: main.mlang -> main.mlang",
+		},
+		{
+			map[string]string{
+				"main.mlang": `import "lib.mlang" as lib`,
+				"lib.mlang":  "x = (1",
+			},
+			"lib.mlang:1:7: expected ), got EOF instead",
+		},
+		{
+			map[string]string{
+				"main.mlang": `import "lib.mlang" as lib`,
+				"lib.mlang":  "x = 1 + true",
+			},
+			"lib.mlang:1:7: type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			map[string]string{
+				"main.mlang": `import "lib.mlang" as lib; lib.y`,
+				"lib.mlang":  "x = 1",
+			},
+			"main.mlang:1:31: module lib.mlang has no member y",
+		},
+	}
+
+	for i, tt := range tests {
+		dir := writeFiles(t, tt.files)
+		for name, run := range runners {
+			_, err := runFile(t, run, nil, filepath.Join(dir, "main.mlang"))
+			if err == nil {
+				t.Fatalf("tests[%d] %s: should fail with %q", i, name, tt.err)
+			}
+			message := strings.ReplaceAll(err.Pos.String()+": "+err.Message, dir+string(filepath.Separator), "")
+			if message != tt.err {
+				t.Errorf("tests[%d] %s: error should be %q, got %q", i, name, tt.err, message)
+			}
+		}
+	}
+}
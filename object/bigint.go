@@ -0,0 +1,20 @@
+package object
+
+import "math/big"
+
+// BigInt целое число, которое не помещается в int64. Результаты, которые помещаются в int64,
+// снова становятся Integer, поэтому каждое значение представлено только одним из типов
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+
+// IntegerFromBig возвращает Integer, если значение помещается в int64, иначе BigInt
+func IntegerFromBig(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
@@ -1,6 +1,7 @@
 package object
 
-type BuiltinFunction func(args ...Object) Object
+// BuiltinFunction встроенная функция. ctx - окружение потока выполнения, из которого она вызвана
+type BuiltinFunction func(ctx *Context, args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
@@ -0,0 +1,71 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrClosedChannel = errors.New("channel is closed")
+	ErrInterrupted   = errors.New("operation is interrupted")
+)
+
+// Channel канал для обмена значениями между задачами, построенный на канале Go
+type Channel struct {
+	mu     sync.Mutex
+	closed bool
+	Ch     chan Object
+}
+
+// MaxChannelCapacity наибольший размер буфера канала. Буфер выделяется сразу при создании канала,
+// поэтому размер ограничен, чтобы опечатка в chan(...) не исчерпала память
+const MaxChannelCapacity = 1 << 24
+
+// NewChannel создает канал с буфером capacity от 0 до MaxChannelCapacity
+func NewChannel(capacity int) *Channel {
+	return &Channel{Ch: make(chan Object, capacity)}
+}
+
+// Send блокируется до передачи значения или закрытия done, во втором случае возвращает ErrInterrupted.
+// Отправка в закрытый канал (в том числе закрытый во время ожидания) возвращает ErrClosedChannel
+func (c *Channel) Send(value Object, done <-chan struct{}) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = ErrClosedChannel
+		}
+	}()
+	select {
+	case c.Ch <- value:
+		return nil
+	case <-done:
+		return ErrInterrupted
+	}
+}
+
+// Recv блокируется до получения значения или закрытия done, во втором случае возвращает ErrInterrupted.
+// ok равен false, если канал закрыт и пуст
+func (c *Channel) Recv(done <-chan struct{}) (value Object, ok bool, err error) {
+	select {
+	case value, ok = <-c.Ch:
+		return value, ok, nil
+	case <-done:
+		return nil, false, ErrInterrupted
+	}
+}
+
+func (c *Channel) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosedChannel
+	}
+	c.closed = true
+	close(c.Ch)
+	return nil
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string {
+	return fmt.Sprintf("<channel %d/%d>", len(c.Ch), cap(c.Ch))
+}
@@ -0,0 +1,57 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"mlang/token"
+	"sort"
+)
+
+// SourceMapEntry позиция узла программы, из которого получены инструкции, начиная со смещения Offset
+type SourceMapEntry struct {
+	Offset int
+	Pos    token.TokenPosition
+}
+
+// CompiledFunction функция, скомпилированная в байт-код для виртуальной машины
+type CompiledFunction struct {
+	Instructions []byte
+	SourceMap    []SourceMapEntry // упорядочен по Offset
+	Parameters   []string
+	Locals       []string // имена локальных переменных, первыми идут параметры
+	Constants    []Object // пул констант, общий для функций одной компиляции
+}
+
+func (f *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (f *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("<compiled function %d bytes>", len(f.Instructions))
+}
+
+// Pos возвращает позицию узла программы, из которого получена инструкция по смещению offset
+func (f *CompiledFunction) Pos(offset int) token.TokenPosition {
+	i := sort.Search(len(f.SourceMap), func(i int) bool { return f.SourceMap[i].Offset > offset })
+	if i == 0 {
+		return token.TokenPosition{}
+	}
+	return f.SourceMap[i-1].Pos
+}
+
+// Closure скомпилированная функция вместе с окружением, в котором она создана
+type Closure struct {
+	Fn      *CompiledFunction
+	Env     *Environment
+	Globals *Environment // глобальные переменные программы или модуля, в котором создана функция
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("<function (")
+	for _, p := range c.Fn.Parameters {
+		out.WriteString(p)
+		out.WriteString(" ")
+	}
+	out.WriteString(")>")
+	return out.String()
+}
@@ -0,0 +1,47 @@
+package object
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// Context окружение, в котором выполняются встроенные функции: потоки ввода-вывода программы,
+// вызов функций языка в том потоке выполнения, из которого вызвана встроенная функция,
+// и загрузка модулей для import
+type Context struct {
+	In   *bufio.Reader
+	Out  io.Writer
+	Err  io.Writer
+	Call func(fn Object, args []Object) Object
+	// Import возвращает *Module или *Error для пути path из инструкции import в файле from.
+	// ctx - контекст выполнения импортирующей программы, модуль выполняется с ним.
+	// Если Import не задан, импорт модулей недоступен
+	Import func(ctx context.Context, path string, from string) Object
+	// Run контекст выполнения программы. Встроенные функции, ожидающие задачу, канал или ввод,
+	// прерывают ожидание при его отмене. Если Run не задан, ожидание не прерывается
+	Run context.Context
+
+	input *input
+}
+
+// NewContext создает окружение с потоками ввода-вывода. Ввод буферизуется, поэтому все чтения
+// одного потока должны идти через одно окружение
+func NewContext(in io.Reader, out io.Writer, err io.Writer) *Context {
+	source := &chunkReader{src: in}
+	return &Context{In: bufio.NewReader(source), Out: out, Err: err, input: &input{source: source}}
+}
+
+// WithCall возвращает окружение с теми же потоками ввода-вывода для другого потока выполнения
+func (c *Context) WithCall(call func(fn Object, args []Object) Object) *Context {
+	ctx := *c
+	ctx.Call = call
+	return &ctx
+}
+
+// WithImport возвращает окружение с теми же потоками ввода-вывода и другой загрузкой модулей
+func (c *Context) WithImport(load func(ctx context.Context, path string, from string) Object) *Context {
+	ctx := *c
+	ctx.Import = load
+	return &ctx
+}
@@ -1,31 +1,174 @@
 package object
 
+import "sync"
+
+// Environment переменные одного вызова функции или глобальные переменные программы.
+// Переменные хранятся в ячейках, номера которых назначаются при разрешении имен (пакет resolver),
+// а окружения вложенных функций ссылаются на окружение, в котором функция создана.
+// Окружение может разделяться между задачами, запущенными через fork, поэтому доступ к ячейкам защищен мьютексом.
+//
+// Массив или словарь, записанный в ячейку через Update, принадлежит потоку выполнения, который его записал,
+// пока значение ячейки не прочитано через Get или не заменено. Других ссылок на такое значение нет,
+// поэтому владелец может изменять его на месте, а не копировать при каждом присваивании элементу
 type Environment struct {
-	store map[string]Object
-	outer *Environment
-	lvl   int
+	mu     sync.RWMutex
+	store  []Object
+	owners []interface{} // владельцы значений ячеек, создается при первом Update
+	names  []string
+	index  map[string]int // номера ячеек по именам, только у глобального окружения
+	outer  *Environment
 }
 
+// NewEnvironment создает окружение глобальных переменных. Переменные в нем заводит resolver,
+// поэтому одно окружение можно использовать для нескольких программ (строк в интерактивном режиме)
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{index: make(map[string]int)}
+}
+
+// NewEnclosedEnvironment создает окружение вызова функции с локальными переменными names
+func NewEnclosedEnvironment(outer *Environment, names []string) *Environment {
+	return &Environment{store: make([]Object, len(names)), names: names, outer: outer}
+}
+
+// Define заводит переменную и возвращает номер ее ячейки. Для уже существующей переменной
+// возвращается прежний номер. Вызывается при разрешении имен, до выполнения программы
+func (e *Environment) Define(name string) int {
+	if slot, ok := e.Lookup(name); ok {
+		return slot
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	slot := len(e.names)
+	e.names = append(e.names, name)
+	e.store = append(e.store, nil)
+	if e.index != nil {
+		e.index[name] = slot
+	}
+	return slot
 }
 
-func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+// Lookup возвращает номер ячейки переменной этого окружения
+func (e *Environment) Lookup(name string) (int, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.index != nil {
+		slot, ok := e.index[name]
+		return slot, ok
+	}
+	for slot, n := range e.names {
+		if n == name {
+			return slot, true
+		}
+	}
+	return 0, false
+}
+
+// Get возвращает значение переменной окружения, находящегося на depth уровней выше,
+// или nil, если переменной еще ничего не присвоено. После чтения у значения нет владельца
+func (e *Environment) Get(depth int, slot int) Object {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	return e.get(slot, nil)
+}
+
+// Peek возвращает значение переменной, как Get, но владелец owner сохраняет значение.
+// Используется, когда ссылка на значение не сохраняется, например для чтения элемента a[i]
+func (e *Environment) Peek(depth int, slot int, owner interface{}) Object {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	return e.get(slot, owner)
+}
+
+func (e *Environment) get(slot int, owner interface{}) Object {
+	e.mu.RLock()
+	val, current := e.store[slot], e.owner(slot)
+	e.mu.RUnlock()
+	if current == nil || current == owner {
+		return val
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.owners[slot] = nil
+	return e.store[slot]
 }
 
-func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+func (e *Environment) owner(slot int) interface{} {
+	if slot < len(e.owners) {
+		return e.owners[slot]
 	}
-	return obj, ok
+	return nil
 }
 
-func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+func (e *Environment) Set(depth int, slot int, val Object) Object {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	e.mu.Lock()
+	e.set(slot, val, nil)
+	e.mu.Unlock()
+	return val
+}
+
+func (e *Environment) set(slot int, val Object, owner interface{}) {
+	e.store[slot] = val
+	if owner != nil && len(e.owners) < len(e.store) {
+		owners := make([]interface{}, len(e.store))
+		copy(owners, e.owners)
+		e.owners = owners
+	}
+	if slot < len(e.owners) {
+		e.owners[slot] = owner
+	}
+}
+
+// Update заменяет значение переменной результатом update, который вызывается под блокировкой окружения
+// с текущим значением и признаком owned: значение принадлежит owner и его можно изменить на месте.
+// Новое значение принадлежит owner. Если update вернул nil или *Error, значение переменной не меняется
+func (e *Environment) Update(depth int, slot int, owner interface{}, update func(val Object, owned bool) Object) Object {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	val := update(e.store[slot], e.owner(slot) == owner)
+	if _, ok := val.(*Error); ok || val == nil {
+		return val
+	}
+	e.set(slot, val, owner)
 	return val
 }
+
+// Name возвращает имя переменной в ячейке slot окружения, находящегося на depth уровней выше
+func (e *Environment) Name(depth int, slot int) string {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.names[slot]
+}
+
+// Names возвращает имена переменных этого окружения по номерам ячеек
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, len(e.names))
+	copy(names, e.names)
+	return names
+}
+
+// Assign присваивает значение ближайшей видимой из окружения переменной с именем name
+func (e *Environment) Assign(name string, val Object) bool {
+	for ; e != nil; e = e.outer {
+		if slot, ok := e.Lookup(name); ok {
+			e.mu.Lock()
+			e.set(slot, val, nil)
+			e.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
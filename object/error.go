@@ -1,8 +1,95 @@
 package object
 
+import (
+	"fmt"
+	"mlang/token"
+	"strings"
+)
+
+// StackFrame вызов функции, через который прошла ошибка
+type StackFrame struct {
+	Function string // имя функции, если его удалось определить по месту вызова
+	Pos      token.TokenPosition
+	Args     int
+}
+
+func (f StackFrame) String() string {
+	plural := "s"
+	if f.Args == 1 {
+		plural = ""
+	}
+	return fmt.Sprintf("%s(%d arg%s) at %s", f.Function, f.Args, plural, f.Pos)
+}
+
+// Виды ошибок, по которым их различают в блоке catch. Ошибки без вида считаются RUNTIME_ERROR
+const (
+	RUNTIME_ERROR   = "runtime"
+	THROWN_ERROR    = "error" // ошибка, брошенная через throw без указания вида
+	TYPE_ERROR      = "type"
+	NAME_ERROR      = "name"
+	INDEX_ERROR     = "index"
+	ARGUMENT_ERROR  = "argument"
+	DIVISION_ERROR  = "division"
+	INPUT_ERROR     = "input" // ввод не соответствует ожидаемому формату
+	EOF_ERROR       = "eof"   // ввод закончился
+	RECURSION_ERROR = "recursion"
+	LIMIT_ERROR     = "limit"
+	IMPORT_ERROR    = "import" // модуль не найден, содержит синтаксические ошибки или импортируется циклически
+)
+
 type Error struct {
 	Message string
+	Kind    string
+	Pos     token.TokenPosition
+	Stack   []StackFrame // от самого глубокого вызова к внешнему
+	Err     error        // причина ошибки для кода на Go, например превышенное ограничение выполнения
+	Value   Object       // значение, переданное в throw
+}
+
+// NewError создает ошибку вида kind
+func NewError(kind string, format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Kind: kind}
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+func (e *Error) Error() string { return e.Inspect() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Copy возвращает копию ошибки, стек которой можно дополнять независимо
+func (e *Error) Copy() *Error {
+	stack := make([]StackFrame, len(e.Stack))
+	copy(stack, e.Stack)
+	return &Error{Message: e.Message, Kind: e.Kind, Pos: e.Pos, Stack: stack, Err: e.Err, Value: e.Value}
+}
+
+// StackTrace форматирует стек вызовов, сворачивая подряд идущие одинаковые вызовы
+func (e *Error) StackTrace() string {
+	if len(e.Stack) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	out.WriteString("Traceback (most recent call first):\n")
+	for i := 0; i < len(e.Stack); {
+		frame := e.Stack[i]
+		repeated := 0
+		for i+repeated+1 < len(e.Stack) && e.Stack[i+repeated+1] == frame {
+			repeated++
+		}
+
+		out.WriteString("  " + frame.String() + "\n")
+		if repeated > 0 {
+			fmt.Fprintf(&out, "  [previous call repeated %d more times]\n", repeated)
+		}
+		i += repeated + 1
+	}
+
+	return out.String()
+}
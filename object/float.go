@@ -0,0 +1,23 @@
+package object
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect форматирует число кратчайшей записью, которая читается обратно в то же значение.
+// У целых значений остается дробная часть, чтобы 2.0 отличалось от целого 2
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if math.IsInf(f.Value, 0) || math.IsNaN(f.Value) || strings.ContainsAny(s, ".e") {
+		return s
+	}
+	return s + ".0"
+}
@@ -8,6 +8,7 @@ import (
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
+	Locals     []string // имена локальных переменных, первыми идут параметры
 	Env        *Environment
 }
 
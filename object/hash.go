@@ -0,0 +1,135 @@
+package object
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// HashKey однозначно определяет значение ключа словаря
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Text  string
+}
+
+// Hashable реализуют объекты, которые могут быть ключами словаря
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *BigInt) HashKey() HashKey {
+	return HashKey{Type: b.Type(), Text: b.Value.String()}
+}
+
+// HashKey дробного числа без дробной части совпадает с ключом равного ему целого числа,
+// потому что 1 == 1.0 и -0.0 == 0
+func (f *Float) HashKey() HashKey {
+	value := f.Value
+	if value == math.Trunc(value) && !math.IsInf(value, 0) {
+		if value >= -(1<<63) && value < 1<<63 {
+			return (&Integer{Value: int64(value)}).HashKey()
+		}
+		n, _ := big.NewFloat(value).Int(nil)
+		return (&BigInt{Value: n}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Text: s.Value}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash словарь, сохраняющий порядок добавления ключей
+type Hash struct {
+	pairs map[HashKey]HashPair
+	keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+func (h *Hash) Set(key Hashable, value Object) {
+	hk := key.HashKey()
+	if _, ok := h.pairs[hk]; !ok {
+		h.keys = append(h.keys, hk)
+	}
+	h.pairs[hk] = HashPair{Key: key, Value: value}
+}
+
+func (h *Hash) Delete(key Hashable) {
+	hk := key.HashKey()
+	if _, ok := h.pairs[hk]; !ok {
+		return
+	}
+	delete(h.pairs, hk)
+	for i, k := range h.keys {
+		if k == hk {
+			h.keys = append(h.keys[:i], h.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (h *Hash) Len() int {
+	return len(h.keys)
+}
+
+// Pairs возвращает пары ключ-значение в порядке добавления
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.keys))
+	for _, k := range h.keys {
+		pairs = append(pairs, h.pairs[k])
+	}
+	return pairs
+}
+
+// Copy возвращает поверхностную копию словаря
+func (h *Hash) Copy() *Hash {
+	copied := NewHash()
+	for _, pair := range h.Pairs() {
+		copied.Set(pair.Key.(Hashable), pair.Value)
+	}
+	return copied
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.Pairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
@@ -0,0 +1,103 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// input ввод программы. Источник читает одна горутина, которая передает прочитанное через канал,
+// поэтому прерванное ожидание ввода не оставляет в фоне чтение, конкурирующее со следующим
+type input struct {
+	mu     sync.Mutex // чтения выполняются по одному
+	source *chunkReader
+}
+
+// chunk прочитанный из источника кусок данных или ошибка чтения
+type chunk struct {
+	data []byte
+	err  error
+}
+
+// chunkReader читает источник в отдельной горутине, запускаемой при первом чтении.
+// Горутина читает следующий кусок, только когда предыдущий получен, как и bufio.Reader,
+// поэтому ошибки источника (в том числе io.EOF) не запоминаются навсегда
+type chunkReader struct {
+	src    io.Reader
+	start  sync.Once
+	chunks chan chunk
+	rest   []byte // полученные, но еще не отданные данные
+
+	done        <-chan struct{} // прерывает ожидание куска
+	interrupted bool
+	recording   bool
+	taken       []byte // данные, отданные с начала текущего чтения
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.rest) == 0 {
+		r.start.Do(func() {
+			r.chunks = make(chan chunk)
+			go r.readSource()
+		})
+		select {
+		case c := <-r.chunks:
+			if c.err != nil {
+				return 0, c.err
+			}
+			r.rest = c.data
+		case <-r.done:
+			r.interrupted = true
+			return 0, ErrInterrupted
+		}
+	}
+
+	n := copy(p, r.rest)
+	if r.recording {
+		r.taken = append(r.taken, r.rest[:n]...)
+	}
+	r.rest = r.rest[n:]
+	return n, nil
+}
+
+func (r *chunkReader) readSource() {
+	for {
+		buf := make([]byte, 4096)
+		n, err := r.src.Read(buf)
+		if n > 0 {
+			r.chunks <- chunk{data: buf[:n]}
+		}
+		if err != nil {
+			r.chunks <- chunk{err: err}
+		}
+	}
+}
+
+// Read выполняет чтение read из ввода окружения. Если done закрывается раньше, чем появились нужные
+// чтению данные, возвращается ErrInterrupted, а уже полученные чтением данные возвращаются во ввод,
+// поэтому следующее чтение получит ввод с того же места
+func (c *Context) Read(done <-chan struct{}, read func(in *bufio.Reader) error) error {
+	if c.input == nil {
+		return read(c.In)
+	}
+	c.input.mu.Lock()
+	defer c.input.mu.Unlock()
+	if done == nil {
+		return read(c.In)
+	}
+
+	source := c.input.source
+	buffered, _ := c.In.Peek(c.In.Buffered())
+	taken := append([]byte(nil), buffered...)
+	source.done, source.interrupted, source.recording, source.taken = done, false, true, taken
+	defer func() { source.done, source.recording, source.taken = nil, false, nil }()
+
+	err := read(c.In)
+	if !source.interrupted {
+		return err
+	}
+	// буфер c.In содержит конец taken, поэтому сбрасывается
+	source.rest = append(source.taken, source.rest...)
+	c.In.Reset(source)
+	return ErrInterrupted
+}
@@ -0,0 +1,14 @@
+package object
+
+// Break и Continue - сигналы управления циклом, которые поднимаются
+// из тела цикла так же, как ReturnValue из тела функции
+
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
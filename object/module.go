@@ -0,0 +1,21 @@
+package object
+
+// Module выполненный модуль. Его глобальные переменные доступны через имя модуля: lib.name
+type Module struct {
+	Name string // путь файла модуля
+	Env  *Environment
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "<module " + m.Name + ">" }
+
+// Member возвращает значение глобальной переменной модуля. Второй результат false,
+// если переменной нет или ей ничего не присвоено
+func (m *Module) Member(name string) (Object, bool) {
+	slot, ok := m.Env.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+	value := m.Env.Get(0, slot)
+	return value, value != nil
+}
@@ -0,0 +1,10 @@
+package object
+
+import "strconv"
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return strconv.Quote(s.Value) }
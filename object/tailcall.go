@@ -0,0 +1,11 @@
+package object
+
+// TailCall вызов функции в хвостовой позиции. Поднимается из тела функции так же, как ReturnValue,
+// а вызывающий выполняет его на месте завершившейся функции, не увеличивая глубину рекурсии
+type TailCall struct {
+	Fn   *Function
+	Args []Object
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call" }
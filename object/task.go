@@ -0,0 +1,45 @@
+package object
+
+// Task результат вызова функции, запущенного через fork в отдельной горутине
+type Task struct {
+	done   chan struct{}
+	result Object
+}
+
+func NewTask() *Task {
+	return &Task{done: make(chan struct{})}
+}
+
+// Resolve сохраняет результат задачи и будит всех ожидающих. Вызывается один раз
+func (t *Task) Resolve(result Object) {
+	t.result = result
+	close(t.done)
+}
+
+// Await блокируется до завершения задачи и возвращает ее результат
+func (t *Task) Await() Object {
+	<-t.done
+	return t.result
+}
+
+// Finished возвращает канал, который закрывается по завершении задачи
+func (t *Task) Finished() <-chan struct{} {
+	return t.done
+}
+
+func (t *Task) Done() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string {
+	if t.Done() {
+		return "<task done>"
+	}
+	return "<task running>"
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"fmt"
+	"mlang/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// Коды ошибок разбора
+const (
+	ErrUnexpectedToken     = "E001" // ожидался другой токен
+	ErrExpectedExpr        = "E002" // ожидалось выражение
+	ErrExpectedStmtEnd     = "E003" // выражение не завершено
+	ErrInvalidNumber       = "E004" // некорректный числовой литерал
+	ErrForkWithoutCall     = "E005" // после fork нет вызова функции
+	ErrUnterminatedBlock   = "E006" // блок не закрыт до конца файла
+	ErrTooManyErrors       = "E007" // разбор остановлен после MAX_ERRORS ошибок
+	ErrInvalidAssignTarget = "E009" // присваивание тому, что не является переменной, индексом или образцом
+)
+
+// MAX_ERRORS количество ошибок, после которого разбор прекращается
+const MAX_ERRORS = 10
+
+// Error ошибка разбора с позицией, кодом и подсказкой для исправления
+type Error struct {
+	Pos     token.TokenPosition
+	Length  int // длина подчеркиваемого фрагмента в символах
+	Code    string
+	Message string
+	Hint    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ERROR: %s: %s", e.Pos, e.Message)
+}
+
+// addError добавляет ошибку, относящуюся к токену tok.
+// Из нескольких ошибок в одной позиции сохраняется первая, остальные - следствия первой.
+// После MAX_ERRORS ошибок добавляется итоговая ошибка E007, а новые отбрасываются
+func (p *Parser) addError(tok token.Token, code string, format string, a ...interface{}) *Error {
+	length := utf8.RuneCountInString(tok.Literal)
+	if tok.Type == token.EOF || length == 0 {
+		length = 1
+	}
+
+	err := &Error{
+		Pos:     tok.Pos,
+		Length:  length,
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+
+	if p.tooManyErrors() {
+		return err
+	}
+	for _, prev := range p.errors {
+		if prev.Pos == err.Pos {
+			return err
+		}
+	}
+
+	p.errors = append(p.errors, err)
+	if len(p.errors) == MAX_ERRORS {
+		p.errors = append(p.errors, &Error{
+			Pos:     tok.Pos,
+			Length:  length,
+			Code:    ErrTooManyErrors,
+			Message: "too many errors",
+		})
+	}
+	return err
+}
+
+func (p *Parser) tooManyErrors() bool {
+	return len(p.errors) > MAX_ERRORS
+}
+
+func (p *Parser) peekError(t token.TokenType, msg string) *Error {
+	if msg == "" {
+		msg = string(t)
+	}
+	return p.addError(p.peekToken, ErrUnexpectedToken, "expected %s, got %s instead", msg, p.peekToken.Type)
+}
+
+func (p *Parser) curError(t token.TokenType, msg string) *Error {
+	if msg == "" {
+		msg = string(t)
+	}
+	return p.addError(p.curToken, ErrUnexpectedToken, "expected %s, got %s instead", msg, p.curToken.Type)
+}
+
+func (p *Parser) noPrefixFnError(t string) {
+	err := p.addError(p.curToken, ErrExpectedExpr, "expected expression, got %s instead", t)
+	err.Hint = illegalTokenHint(p.curToken)
+}
+
+// illegalTokenHint пытается угадать, что имелось в виду на месте некорректного токена
+func illegalTokenHint(tok token.Token) string {
+	if tok.Type != token.ILLEGAL {
+		return ""
+	}
+	switch {
+	case tok.Literal == "/*":
+		return "block comment is not closed"
+	case strings.HasPrefix(tok.Literal, `"`):
+		return "check for unterminated string literal"
+	case strings.HasPrefix(tok.Literal, `\`):
+		return "unknown escape sequence, use \\n, \\t, \\\", \\\\ or \\uXXXX"
+	case len(tok.Literal) > 0 && isDigit(tok.Literal[0]):
+		return "identifiers can not start with a digit"
+	default:
+		return "unexpected character"
+	}
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
@@ -9,48 +9,85 @@ package parser
 */
 
 import (
-	"fmt"
+	"math/big"
 	"mlang/ast"
 	"mlang/lexer"
 	"mlang/token"
 	"strconv"
 )
 
+// Приоритеты операторов от меньшего к большему. Побитовые операторы связывают сильнее сравнений,
+// поэтому x & 1 == 0 означает (x & 1) == 0. Все бинарные операторы левоассоциативны, кроме **
 const (
 	_ int = iota
 	LOWEST
-	LOGIC_SUM
-	LOGIC_AND
-	EQUALS
-	LESSGREATER
-	SUM
-	PRODUCT
-	PREFIX
+	LOGIC_SUM   // || ^
+	LOGIC_AND   // &&
+	EQUALS      // == !=
+	LESSGREATER // < > <= >=
+	BIT_OR      // |
+	BIT_XOR     // ~
+	BIT_AND     // &
+	SHIFT       // << >>
+	SUM         // + -
+	PRODUCT     // * / ~/ %
+	PREFIX      // -x !x ~x
+	POWER       // **, правоассоциативный: -2 ** 2 == -(2 ** 2)
 	CALL
+	INDEX
 )
 
 var precedences = map[token.TokenType]int{
-	token.CARET:            LOGIC_SUM,
 	token.DOUBLE_PIPE:      LOGIC_SUM,
 	token.DOUBLE_AMPERSAND: LOGIC_AND,
 	token.EQUAL:            EQUALS,
 	token.NOT_EQUAL:        EQUALS,
 	token.LT:               LESSGREATER,
 	token.GT:               LESSGREATER,
+	token.LT_EQUAL:         LESSGREATER,
+	token.GT_EQUAL:         LESSGREATER,
+	token.PIPE:             BIT_OR,
+	token.CARET:            LOGIC_SUM,
+	token.TILDE:            BIT_XOR,
+	token.AMPERSAND:        BIT_AND,
+	token.SHIFT_LEFT:       SHIFT,
+	token.SHIFT_RIGHT:      SHIFT,
 	token.PLUS:             SUM,
 	token.MINUS:            SUM,
 	token.DIV:              PRODUCT,
 	token.MUL:              PRODUCT,
+	token.INT_DIV:          PRODUCT,
+	token.MOD:              PRODUCT,
+	token.POWER:            POWER,
 	token.LPAREN:           CALL,
+	token.LBRACKET:         INDEX,
+	token.DOT:              INDEX,
+}
+
+// rightAssociative операторы, правый операнд которых может содержать оператор того же приоритета
+var rightAssociative = map[token.TokenType]bool{
+	token.POWER: true,
 }
 
 // token that ends expression
 var separators = map[token.TokenType]bool{
 	token.RBRACE:    true,
 	token.RPAREN:    true,
+	token.RBRACKET:  true,
 	token.EOF:       true,
 	token.SEMICOLON: true,
 	token.COMMA:     true,
+	token.COLON:     true,
+}
+
+// assignOperators операторы присваивания и соответствующие им бинарные операторы
+var assignOperators = map[token.TokenType]string{
+	token.ASSIGN:       "",
+	token.PLUS_ASSIGN:  "+",
+	token.MINUS_ASSIGN: "-",
+	token.MUL_ASSIGN:   "*",
+	token.DIV_ASSIGN:   "/",
+	token.MOD_ASSIGN:   "%",
 }
 
 type (
@@ -64,14 +101,21 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	errors []string
+	errors []*Error
+
+	// разбирается условие if или while
+	inCondition bool
+	// разбирается левая часть присваивания
+	inAssignTarget bool
+	// глубина вложенности разбираемых блоков
+	blockDepth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []*Error{}}
 
 	p.nextToken()
 	p.nextToken()
@@ -79,14 +123,21 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.NULL, p.parseNull)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.FORK, p.parseForkExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -95,12 +146,24 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.DIV, p.parseInfixExpression)
 	p.registerInfix(token.EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.TILDE, p.parseInfixExpression)
 	p.registerInfix(token.DOUBLE_AMPERSAND, p.parseInfixExpression)
 	p.registerInfix(token.DOUBLE_PIPE, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQUAL, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQUAL, p.parseInfixExpression)
+	p.registerInfix(token.MOD, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.INT_DIV, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseSelectorExpression)
 	return p
 }
 
@@ -108,8 +171,8 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
+	for p.curToken.Type != token.EOF && !p.tooManyErrors() {
+		stmt := p.parseStatementOrSync()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -119,6 +182,49 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// parseStatementOrSync разбирает инструкцию, а если в ней нашлись ошибки,
+// пропускает токены до ее конца, чтобы следующие ошибки не были следствием первой
+func (p *Parser) parseStatementOrSync() ast.Statement {
+	errors := len(p.errors)
+	stmt := p.parseStatement()
+	if len(p.errors) > errors {
+		p.synchronize()
+	}
+	return stmt
+}
+
+// synchronize пропускает токены до конца текущей инструкции: до ';' (или перевода строки)
+// вне вложенных скобок или до '}', закрывающей блок, в котором находится инструкция
+func (p *Parser) synchronize() {
+	depth := 0
+	switch p.curToken.Type {
+	case token.SEMICOLON:
+		return
+	case token.LBRACE, token.LPAREN, token.LBRACKET:
+		depth++
+	}
+
+	for !p.peekTokenIs(token.EOF) {
+		if depth == 0 && p.blockDepth > 0 && p.peekTokenIs(token.RBRACE) {
+			return
+		}
+		p.nextToken()
+
+		switch p.curToken.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			if depth > 0 {
+				depth--
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
 func (p *Parser) registerPrefix(t token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[t] = fn
 }
@@ -128,27 +234,16 @@ func (p *Parser) registerInfix(t token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) Errors() []string {
-	return p.errors
-}
-
-func (p *Parser) peekError(t token.TokenType, msg string) {
-	var err_msg string
-	if msg != "" {
-		err_msg = fmt.Sprintf("ERROR: expected %s, got %s instead", msg, p.peekToken.Type)
-	} else {
-		err_msg = fmt.Sprintf("ERROR: expected %s, got %s instead", t, p.peekToken.Type)
+	msgs := make([]string, 0, len(p.errors))
+	for _, err := range p.errors {
+		msgs = append(msgs, err.Error())
 	}
-	p.errors = append(p.errors, err_msg)
+	return msgs
 }
 
-func (p *Parser) curError(t token.TokenType, msg string) {
-	var err_msg string
-	if msg == "" {
-		err_msg = fmt.Sprintf("ERROR: expected %s, got %s insted", t, p.curToken.Type)
-	} else {
-		err_msg = fmt.Sprintf("ERROR: expected %s, got %s instead", msg, p.curToken.Type)
-	}
-	p.errors = append(p.errors, err_msg)
+// Diagnostics возвращает ошибки разбора с кодами и подсказками
+func (p *Parser) Diagnostics() []*Error {
+	return p.errors
 }
 
 func (p *Parser) nextToken() {
@@ -160,10 +255,31 @@ func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	case token.LBRACE:
-		return p.parseBlockStatement()
-	case token.IDENT:
-		if p.peekToken.Type == token.ASSIGN {
+		if p.isAssignment() {
+			return p.parseAssignStatement()
+		}
+		if p.isHashLiteralStart() {
+			return p.parseExpressionStatement()
+		}
+		if block := p.parseBlockStatement(); block != nil {
+			return block
+		}
+		return nil
+	case token.IDENT, token.LBRACKET:
+		if p.isAssignment() {
 			return p.parseAssignStatement()
 		}
 		fallthrough
@@ -172,17 +288,38 @@ func (p *Parser) parseStatement() ast.Statement {
 	}
 }
 
+// parseAssignStatement разбирает присваивание: цели через запятую, оператор и значения через запятую
 func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 	stmt := &ast.AssignStatement{Token: p.curToken}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	var targets, values bool
+	stmt.Target, targets = p.parseAssignList(true)
+	if stmt.Target == nil {
+		return nil
+	}
 
-	if !p.expectPeek(token.ASSIGN, "") {
+	p.nextToken()
+	operatorToken := p.curToken
+	operator, ok := assignOperators[p.curToken.Type]
+	if !ok {
+		p.curError(token.ASSIGN, "")
 		return nil
 	}
+	stmt.Operator = operator
 
 	p.nextToken()
-	stmt.Value = p.parseExpression(LOWEST)
+	stmt.Value, values = p.parseAssignList(false)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if operator != "" && (targets || values || !isSingleTarget(stmt.Target)) {
+		p.addError(operatorToken, ErrInvalidAssignTarget, "%s= requires a single variable or index and a single value", operator)
+		return nil
+	}
+	if !p.checkAssignTarget(stmt.Target) {
+		return nil
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -191,6 +328,73 @@ func (p *Parser) parseAssignStatement() *ast.AssignStatement {
 	return stmt
 }
 
+// parseAssignList разбирает одно выражение или несколько через запятую, объединяя их в ArrayLiteral.
+// Второй результат сообщает, что выражений несколько
+func (p *Parser) parseAssignList(target bool) (ast.Expression, bool) {
+	outer := p.inAssignTarget
+	p.inAssignTarget = target
+	defer func() { p.inAssignTarget = outer }()
+
+	first := p.curToken
+	exp := p.parseExpression(LOWEST)
+	if exp == nil || !p.peekTokenIs(token.COMMA) {
+		return exp, false
+	}
+
+	list := &ast.ArrayLiteral{Token: first, Elements: []ast.Expression{exp}}
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		exp = p.parseExpression(LOWEST)
+		if exp == nil {
+			return nil, true
+		}
+		list.Elements = append(list.Elements, exp)
+	}
+	return list, true
+}
+
+// isSingleTarget сообщает, что цель составного присваивания - переменная или элемент, а не образец
+func isSingleTarget(target ast.Expression) bool {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return true
+	}
+	return false
+}
+
+// checkAssignTarget проверяет, что присваивать можно переменной, индексному выражению от переменной
+// или образцу из них
+func (p *Parser) checkAssignTarget(target ast.Expression) bool {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.IndexExpression:
+		if _, ok := ast.IndexRoot(target).(*ast.Identifier); ok {
+			return true
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range target.Elements {
+			if !p.checkAssignTarget(element) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for _, value := range target.Values {
+			if !p.checkAssignTarget(value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	tok := token.Token{Type: token.ILLEGAL, Literal: target.TokenLiteral(), Pos: target.Pos()}
+	err := p.addError(tok, ErrInvalidAssignTarget, "cannot assign to %s", target.String())
+	err.Hint = "only variables, index expressions and array or hash patterns can be assigned"
+	return false
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -198,7 +402,143 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseImportStatement разбирает import "path" as name
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING, "module path") {
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
+
+	if !p.expectPeek(token.AS, "as") || !p.expectPeek(token.IDENT, "module name") {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
 	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+	if stmt.Value == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN, "(condition)") {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseCondition()
+	if stmt.Condition == nil || !p.expectPeek(token.RPAREN, "") {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE, "{loop body}") {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	if stmt.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN, "(init; condition; step)") {
+		return nil
+	}
+
+	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Init = p.parseStatement()
+		if !p.curTokenIs(token.SEMICOLON) && !p.expectPeek(token.SEMICOLON, "") {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+		if stmt.Condition == nil {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.SEMICOLON, "") {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Step = p.parseStatement()
+	}
+	if !p.expectPeek(token.RPAREN, "") {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE, "{loop body}") {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+	if stmt.Body == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -218,11 +558,6 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
-func (p *Parser) noPrefixFnError(t string) {
-	msg := fmt.Sprintf("ERROR: expected expression, got %s instead", t)
-	p.errors = append(p.errors, msg)
-}
-
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
@@ -230,6 +565,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 	leftExp := prefix()
+	if leftExp == nil {
+		return nil
+	}
 
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -239,15 +577,47 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.nextToken()
 
 		leftExp = infix(leftExp)
+		if leftExp == nil {
+			return nil
+		}
 	}
 
-	if !p.peekSep() && p.peekPrecedence() == LOWEST { // Check if new Expression started
-		p.peekError(token.SEMICOLON, "statement end")
+	if !p.peekSep() && p.peekPrecedence() == LOWEST && !p.peekAssignOperator() { // Check if new Expression started
+		err := p.addError(p.peekToken, ErrExpectedStmtEnd, "expected statement end, got %s instead", p.peekToken.Type)
+		err.Hint = p.statementEndHint()
 		return nil
 	}
 	return leftExp
 }
 
+func (p *Parser) parseCondition() ast.Expression {
+	outer := p.inCondition
+	p.inCondition = true
+	defer func() { p.inCondition = outer }()
+
+	return p.parseExpression(LOWEST)
+}
+
+// peekAssignOperator сообщает, что левая часть присваивания закончилась оператором присваивания
+func (p *Parser) peekAssignOperator() bool {
+	_, ok := assignOperators[p.peekToken.Type]
+	return ok && p.inAssignTarget
+}
+
+// statementEndHint подсказка для выражения, за которым неожиданно начинается другое
+func (p *Parser) statementEndHint() string {
+	switch {
+	case p.peekTokenIs(token.ASSIGN) && p.inCondition:
+		return "did you mean `==`?"
+	case p.peekTokenIs(token.ASSIGN):
+		return "only variables, index expressions and array or hash patterns can be assigned"
+	case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IDENT):
+		return "missing operator or `,` between expressions?"
+	default:
+		return illegalTokenHint(p.peekToken)
+	}
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -264,9 +634,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		// литерал не помещается в int64
+		if value, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = value
+			return lit
+		}
+	}
+	if err != nil {
+		p.addError(p.curToken, ErrInvalidNumber, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, ErrInvalidNumber, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 
@@ -275,6 +665,10 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -284,32 +678,36 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	}
 
 	exp := p.parseExpression(LOWEST)
-
-	if !p.expectPeek(token.RPAREN, "") {
+	if exp == nil || !p.expectPeek(token.RPAREN, "") {
 		return nil
 	}
 
 	return exp
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	args := []ast.Expression{}
 
-	if p.peekTokenIs(token.RPAREN) {
+	if p.peekTokenIs(end) {
 		p.nextToken()
 		return args
 	}
 
-	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
-
-	for p.peekTokenIs(token.COMMA) {
+	for {
 		p.nextToken()
+		arg := p.parseExpression(LOWEST)
+		if arg == nil {
+			return nil
+		}
+		args = append(args, arg)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(token.RPAREN, "") {
+	if !p.expectPeek(end, "") {
 		return nil
 	}
 
@@ -318,10 +716,153 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseCallArguments()
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
 	return exp
 }
 
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	return array
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+	if exp.Index == nil || !p.expectPeek(token.RBRACKET, "") {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseSelectorExpression(left ast.Expression) ast.Expression {
+	exp := &ast.SelectorExpression{Token: p.curToken, Left: left}
+
+	if !p.expectPeek(token.IDENT, "member name") {
+		return nil
+	}
+	exp.Name = p.curToken.Literal
+
+	return exp
+}
+
+// isAssignment отличает присваивание от выражения в начале инструкции:
+// до конца инструкции встречается оператор присваивания вне вложенных скобок
+func (p *Parser) isAssignment() bool {
+	if p.curTokenIs(token.IDENT) {
+		if _, ok := assignOperators[p.peekToken.Type]; ok {
+			return true
+		}
+		if !p.peekTokenIs(token.COMMA) && !p.peekTokenIs(token.LBRACKET) {
+			return false
+		}
+	}
+
+	l := p.l.Clone()
+	depth := 0
+	if !p.curTokenIs(token.IDENT) {
+		depth = 1
+	}
+	for tok := p.peekToken; tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		default:
+			if _, ok := assignOperators[tok.Type]; ok && depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isHashLiteralStart отличает литерал словаря {key: value} от блока в начале выражения:
+// у словаря до конца первого элемента встречается ':' вне вложенных скобок
+func (p *Parser) isHashLiteralStart() bool {
+	l := p.l.Clone()
+	depth := 0
+	for tok := p.peekToken; tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET:
+			depth--
+		case token.RBRACE:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		case token.COLON:
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if key == nil {
+			return nil
+		}
+
+		var value ast.Expression
+		if id, ok := key.(*ast.Identifier); ok && p.inAssignTarget && !p.peekTokenIs(token.COLON) {
+			// сокращенный образец {name} означает {"name": name}
+			key, value = &ast.StringLiteral{Token: id.Token, Value: id.Value}, id
+		} else {
+			if !p.expectPeek(token.COLON, "") {
+				return nil
+			}
+			p.nextToken()
+			if value = p.parseExpression(LOWEST); value == nil {
+				return nil
+			}
+		}
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		for p.peekTokenIs(token.SEMICOLON) { // newline before closing brace
+			p.nextToken()
+		}
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA, ", or }") {
+			return nil
+		}
+	}
+
+	p.nextToken()
+
+	return hash
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
@@ -330,9 +871,8 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 
 	p.nextToken()
-	expression.Condition = p.parseExpression(LOWEST)
-
-	if !p.expectPeek(token.RPAREN, "") {
+	expression.Condition = p.parseCondition()
+	if expression.Condition == nil || !p.expectPeek(token.RPAREN, "") {
 		return nil
 	}
 
@@ -354,22 +894,69 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseTryExpression разбирает try { } catch (e) { } finally { }, один из блоков catch и finally можно опустить
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE, "{try block}") {
+		return nil
+	}
+	if expression.Block = p.parseBlockStatement(); expression.Block == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN, "(error variable)") || !p.expectPeek(token.IDENT, "identifier") {
+			return nil
+		}
+		expression.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN, "") || !p.expectPeek(token.LBRACE, "{catch block}") {
+			return nil
+		}
+		if expression.Catch = p.parseBlockStatement(); expression.Catch == nil {
+			return nil
+		}
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE, "{finally block}") {
+			return nil
+		}
+		if expression.Finally = p.parseBlockStatement(); expression.Finally == nil {
+			return nil
+		}
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.peekError(token.CATCH, "catch or finally")
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.nextToken()
 
-	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) && !p.tooManyErrors() {
+		stmt := p.parseStatementOrSync()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.nextToken()
 	}
 
-	if p.curTokenIs(token.EOF) {
-		p.curError(token.RBRACE, "")
+	if !p.curTokenIs(token.RBRACE) {
+		err := p.addError(p.curToken, ErrUnterminatedBlock, "expected %s, got %s instead", token.RBRACE, p.curToken.Type)
+		err.Hint = "block opened at " + block.Token.Pos.String() + " is not closed"
 		return nil
 	}
 
@@ -428,6 +1015,24 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseForkExpression() ast.Expression {
+	expression := &ast.ForkExpression{Token: p.curToken}
+
+	p.nextToken()
+	exp := p.parseExpression(PREFIX)
+	if exp == nil {
+		return nil
+	}
+	call, ok := exp.(*ast.CallExpression)
+	if !ok {
+		p.addError(expression.Token, ErrForkWithoutCall, "expected function call after fork")
+		return nil
+	}
+	expression.Call = call
+
+	return expression
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -436,6 +1041,9 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 	p.nextToken()
 	expression.Right = p.parseExpression(PREFIX)
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -448,8 +1056,15 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if rightAssociative[p.curToken.Type] {
+		// правый операнд забирает следующий оператор того же приоритета: 2 ** 3 ** 2 == 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"mlang/ast"
 	"mlang/lexer"
+	"strings"
 	"testing"
 )
 
@@ -43,6 +44,50 @@ func TestAssignStatements(t *testing.T) {
 	}
 }
 
+func TestAssignStatementForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		target   string
+		operator string
+		value    string
+	}{
+		{"x += 1", "x", "+", "1"},
+		{"x -= y + 2", "x", "-", "(2+y)"},
+		{"x *= 3", "x", "*", "3"},
+		{"x /= 4", "x", "/", "4"},
+		{"x %= 5", "x", "%", "5"},
+		{"a, b = b, a", "[a, b]", "", "[b, a]"},
+		{"a, b = pair", "[a, b]", "", "pair"},
+		{"[x, y] = pair", "[x, y]", "", "pair"},
+		{"[x, [y, z]] = [1, [2, 3]]", "[x, [y, z]]", "", "[1, [2, 3]]"},
+		{"{name, age} = person", `{"name": name, "age": age}`, "", "person"},
+		{"{\"n\": name, 1: [a, b]} = h", `{"n": name, 1: [a, b]}`, "", "h"},
+		{"arr[i] = v", "(arr[i])", "", "v"},
+		{"m[0][1] += 1", "((m[0])[1])", "+", "1"},
+		{`h["k"] = v`, `(h["k"])`, "", "v"},
+		{"arr[i], x = x, arr[i]", "[(arr[i]), x]", "", "[x, (arr[i])]"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("tests[%d] program.Statements does not contain 1 statement. got=%d", i, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("tests[%d] program.Statements[0] is not ast.AssignStatement. got=%T", i, program.Statements[0])
+		}
+		if stmt.Target.String() != tt.target || stmt.Operator != tt.operator || stmt.Value.String() != tt.value {
+			t.Errorf("tests[%d] expected %s %s= %s, got %s %s= %s",
+				i, tt.target, tt.operator, tt.value, stmt.Target, stmt.Operator, stmt.Value)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	input := `
 	return 5;
@@ -125,6 +170,79 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "123456789012345678901234567890;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("literal.Big not %s. got=%v", "123456789012345678901234567890", literal.Big)
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E+3", 2500},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("tests[%d] stmt is not ast.ExpressionStatement. got=%T", i, program.Statements[0])
+		}
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("tests[%d] exp not *ast.FloatLiteral. got=%T", i, stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("tests[%d] literal.Value not %g. got=%g", i, tt.expected, literal.Value)
+		}
+		if literal.String() != tt.input {
+			t.Errorf("tests[%d] literal.String() not %s. got %s", i, tt.input, literal.String())
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	input := `
 if (1) {
@@ -208,6 +326,7 @@ func TestParsingPrefixExpression(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15;", "-", 15},
+		{"~15;", "~", 15},
 	}
 
 	for _, tt := range prefixTests {
@@ -252,6 +371,17 @@ func TestParsingInfixExpression(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 ~/ 5;", 5, "~/", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 ~ 5;", 5, "~", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 	}
 
 	for _, tt := range infixTests {
@@ -285,6 +415,170 @@ func TestParsingInfixExpression(t *testing.T) {
 	}
 }
 
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a + b * c", "a + (b * c)"},
+		{"a - b - c", "(a - b) - c"},
+		{"a * b % c ~/ d", "((a * b) % c) ~/ d"},
+		{"a ** b ** c", "a ** (b ** c)"},
+		{"-a ** b", "-(a ** b)"},
+		{"a ** -b", "a ** (-b)"},
+		{"a * b ** c", "a * (b ** c)"},
+		{"~a + b", "(~a) + b"},
+		{"a << b + c", "a << (b + c)"},
+		{"a & b << c", "a & (b << c)"},
+		{"a | b ~ c & d", "a | (b ~ (c & d))"},
+		{"a ~ ~b", "a ~ (~b)"},
+		{"a & 1 == 0", "(a & 1) == 0"},
+		{"a | b < c", "(a | b) < c"},
+		{"a <= b == c >= d", "(a <= b) == (c >= d)"},
+		{"a == b && c || d", "((a == b) && c) || d"},
+		{"a ^ b || c", "(a ^ b) || c"},
+		{"a == b ^ c", "(a == b) ^ c"},
+		{"a || b ^ c && d", "(a || b) ^ (c && d)"},
+	}
+
+	parse := func(input string) string {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		return program.String()
+	}
+	for i, tt := range tests {
+		if actual, expected := parse(tt.input), parse(tt.expected); actual != expected {
+			t.Errorf("tests[%d] %q should be parsed as %q, got %q", i, tt.input, expected, actual)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// sum of two numbers
+	add = func(a, /* second */ b) {
+		a + b // result
+	}
+	/* call
+	   it */
+	add(1,
+		// two
+		2
+	)`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program should contain 2 statements, got %d: %q", len(program.Statements), program.String())
+	}
+	assign := program.Statements[0].(*ast.AssignStatement)
+	if assign.Token.Comments[0].Text != "// sum of two numbers" {
+		t.Errorf("statement should keep leading comment, got %v", assign.Token.Comments)
+	}
+	if call := program.Statements[1].String(); call != "add(1, 2)" {
+		t.Errorf("call should be %q, got %q", "add(1, 2)", call)
+	}
+}
+
+func TestArrayLiteral(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	if array.Elements[1].String() != "(2*2)" {
+		t.Errorf("array.Elements[1] is not %q. got=%q", "(2*2)", array.Elements[1].String())
+	}
+}
+
+func TestIndexExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"arr[1 + 1]", "(arr[(1+1)])"},
+		{"a * [1, 2][b]", "(([1, 2][b])*a)"},
+		{"f(x)[0]", "(f(x)[0])"},
+		{"m[0][1]", "((m[0])[1])"},
+		{"lib.x", "lib.x"},
+		{"a * lib.f(x)[0]", "((lib.f(x)[0])*a)"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("tests[%d] program.Statements[0] is not ast.ExpressionStatement. got=%T", i, program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Fatalf("tests[%d] expected %q, got %q", i, tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestHashLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"one": 1, "two": 2}`, `{"one": 1, "two": 2}`},
+		{`h = {1: 1 + 1, true: "a"}`, `{1: (1+1), true: "a"}`},
+		{"h = {}", "{}"},
+		{"h = {\n\tx: [1],\n\ty: 2\n}", "{x: [1], y: 2}"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("tests[%d] program.Statements not contain %d statements. got=%d", i, 1, len(program.Statements))
+		}
+
+		var exp ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.ExpressionStatement:
+			exp = stmt.Expression
+		case *ast.AssignStatement:
+			exp = stmt.Value
+		default:
+			t.Fatalf("tests[%d] unexpected statement %T", i, stmt)
+		}
+
+		hash, ok := exp.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("tests[%d] exp not *ast.HashLiteral. got=%T", i, exp)
+		}
+		if hash.String() != tt.expected {
+			t.Fatalf("tests[%d] expected %q, got %q", i, tt.expected, hash.String())
+		}
+	}
+}
+
 func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 	integ, ok := il.(*ast.IntegerLiteral)
 	if !ok {
@@ -313,6 +607,7 @@ func TestBlockStatement(t *testing.T) {
 		{"{1;2;3;}", 3},
 		{"{1}", 1},
 		{"{}", 0},
+		{"{x}", 1},
 	}
 
 	for _, tt := range tests {
@@ -336,22 +631,145 @@ func TestBlockStatement(t *testing.T) {
 	}
 }
 
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x = x + 1 }", "while(10<x) x x = (1+x);"},
+		{"for (i = 0; i < 10; i = i + 1) { print(i) }", "for(i i = 0;; (10<i); i i = (1+i);) print(i)"},
+		{"for (;;) { break }", "for(; ; ) break;"},
+		{"while (true) {\n\tcontinue\n}", "whiletrue continue;"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("tests[%d] program.Statements not contain %d statements. got=%d", i, 1, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Fatalf("tests[%d] expected %q, got %q", i, tt.expected, program.Statements[0].String())
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { e }", "try f() catch(e) e"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"x = try { 1 } catch (e) { 2 } finally { 3 }", "x x = try 1 catch(e) 2 finally 3;"},
+		{"throw 1 + 2", "throw (2+1);"},
+		{`throw {"message": "m"}`, `throw {"message": "m"};`},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("tests[%d] program.Statements not contain %d statements. got=%d", i, 1, len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Fatalf("tests[%d] expected %q, got %q", i, tt.expected, program.Statements[0].String())
+		}
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	input := `import "lib/math.mlang" as math; math.pi`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements not contain %d statements. got=%d", 2, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Path != "lib/math.mlang" || stmt.Name.Value != "math" {
+		t.Fatalf("import should be lib/math.mlang as math, got %s as %s", stmt.Path, stmt.Name.Value)
+	}
+	if stmt.String() != `import "lib/math.mlang" as math;` {
+		t.Fatalf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestForkExpression(t *testing.T) {
+	input := "t = fork f(1, 2)"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.AssignStatement. got=%T", program.Statements[0])
+	}
+	fork, ok := stmt.Value.(*ast.ForkExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.ForkExpression. got=%T", stmt.Value)
+	}
+	if fork.Call.String() != "f(1, 2)" {
+		t.Fatalf("fork.Call is not %q. got=%q", "f(1, 2)", fork.Call.String())
+	}
+}
+
+func TestNodePosition(t *testing.T) {
+	input := `x = 1
+	f(x, [2])`
+
+	l := lexer.NewFile("pos.mlang", input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "pos.mlang:1:1"},
+		{program.Statements[0].(*ast.AssignStatement).Value, "pos.mlang:1:5"},
+		{call, "pos.mlang:2:3"},
+		{call.Function, "pos.mlang:2:2"},
+		{call.Arguments[1], "pos.mlang:2:7"},
+		{call.Arguments[1].(*ast.ArrayLiteral).Elements[0], "pos.mlang:2:8"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("tests[%d] position of %q should be %s, got %s", i, tt.node.String(), tt.expected, tt.node.Pos())
+		}
+	}
+}
+
 func TestWrongExpression(t *testing.T) {
 	tests := []struct {
 		input string
 		errs  []string
 	}{
-		{"1+", []string{"ERROR: expected expression, got EOF instead"}},
-		{"if ;", []string{"ERROR: expected (condition), got ; instead"}},
-		{"fn (}", []string{
-			"ERROR: expected expression, got } instead",
-			"ERROR: expected ), got EOF instead"},
-		},
-		{"func {1}", []string{
-			"ERROR: expected ([arguments]), got { instead",
-			"ERROR: expected statement end, got { instead"},
-		},
-		{"5 + ()", []string{"ERROR: expected expression, got ) instead"}},
+		{"1+", []string{"ERROR: 1:3: expected expression, got EOF instead"}},
+		{"if ;", []string{"ERROR: 1:4: expected (condition), got ; instead"}},
+		{"fn (}", []string{"ERROR: 1:5: expected expression, got } instead"}},
+		{"func {1}", []string{"ERROR: 1:6: expected ([arguments]), got { instead"}},
+		{"5 + ()", []string{"ERROR: 1:6: expected expression, got ) instead"}},
+		{"while (x) x", []string{"ERROR: 1:11: expected {loop body}, got IDENT instead"}},
+		{"fork 1 + 2", []string{"ERROR: 1:1: expected function call after fork"}},
+		{"for (i = 0) {}", []string{"ERROR: 1:11: expected ;, got ) instead"}},
 	}
 
 	for i, tt := range tests {
@@ -371,6 +789,126 @@ func TestWrongExpression(t *testing.T) {
 	}
 }
 
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input string
+		errs  []string
+	}{
+		{"1 = a\nif {1}\nfunc(a,b)", []string{
+			"ERROR: 1:3: expected statement end, got = instead",
+			"ERROR: 2:4: expected (condition), got { instead",
+			"ERROR: 3:10: expected {function body}, got EOF instead"},
+		},
+		{"f = func() {\n\tx = (1 + ]\n\ty = 2 2\n}\nz = 3 3", []string{
+			"ERROR: 2:11: expected expression, got ] instead",
+			"ERROR: 3:8: expected statement end, got INT instead",
+			"ERROR: 5:7: expected statement end, got INT instead"},
+		},
+		{"x = [1, 2 3]; y = {1: 2 3}", []string{
+			"ERROR: 1:11: expected statement end, got INT instead",
+			"ERROR: 1:25: expected statement end, got INT instead"},
+		},
+	}
+
+	for i, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.errs) {
+			t.Fatalf("test[%d] Parser should has %d errors, has %d: %q", i, len(tt.errs), len(errors), errors)
+		}
+
+		for id, msg := range tt.errs {
+			if errors[id] != msg {
+				t.Errorf("test[%d] Parser should has \"%s\" error, has \"%s\"", i, msg, errors[id])
+			}
+		}
+	}
+}
+
+func TestErrorsLimit(t *testing.T) {
+	input := strings.Repeat("1 = a\n", MAX_ERRORS+5)
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != MAX_ERRORS+1 {
+		t.Fatalf("Parser should has %d errors, has %d", MAX_ERRORS+1, len(diagnostics))
+	}
+
+	last := diagnostics[MAX_ERRORS]
+	if last.Code != ErrTooManyErrors {
+		t.Errorf("last error should has code %s, has %s", ErrTooManyErrors, last.Code)
+	}
+	if last.Pos.String() != fmt.Sprintf("%d:3", MAX_ERRORS) {
+		t.Errorf("last error should be at %d:3, got %s", MAX_ERRORS, last.Pos)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input  string
+		code   string
+		pos    string
+		length int
+		hint   string
+	}{
+		{"if (a = 1) { a }", ErrExpectedStmtEnd, "1:7", 1, "did you mean `==`?"},
+		{"while (x = y) { x }", ErrExpectedStmtEnd, "1:10", 1, "did you mean `==`?"},
+		{"1 = a", ErrExpectedStmtEnd, "1:3", 1, "only variables, index expressions and array or hash patterns can be assigned"},
+		{"a b", ErrExpectedStmtEnd, "1:3", 1, "missing operator or `,` between expressions?"},
+		{"x ? y", ErrExpectedStmtEnd, "1:3", 1, "unexpected character"},
+		{"@x", ErrExpectedExpr, "1:1", 1, "unexpected character"},
+		{"x = $", ErrExpectedExpr, "1:5", 1, "unexpected character"},
+		{"x = \"abc\ny = 1", ErrExpectedExpr, "1:5", 4, "check for unterminated string literal"},
+		{`x = "a\qb"`, ErrExpectedExpr, "1:7", 2, `unknown escape sequence, use \n, \t, \", \\ or \uXXXX`},
+		{`x = "\u12"`, ErrExpectedExpr, "1:6", 4, `unknown escape sequence, use \n, \t, \", \\ or \uXXXX`},
+		{"5ten", ErrExpectedExpr, "1:1", 4, "identifiers can not start with a digit"},
+		{"f = func() {\n\tx", ErrUnterminatedBlock, "2:3", 1, "block opened at 1:12 is not closed"},
+		{"(1 + 2", ErrUnexpectedToken, "1:7", 1, ""},
+		{"x = fork 1", ErrForkWithoutCall, "1:5", 4, ""},
+		{"try { 1 }; 2", ErrUnexpectedToken, "1:10", 1, ""},
+		{"try { 1 } catch { 2 }", ErrUnexpectedToken, "1:17", 1, ""},
+		{"x = 1e400", ErrInvalidNumber, "1:5", 5, ""},
+		{"import lib", ErrUnexpectedToken, "1:8", 3, ""},
+		{`import "lib"`, ErrUnexpectedToken, "1:13", 1, ""},
+		{"lib.1", ErrUnexpectedToken, "1:5", 1, ""},
+		{"x = /* open", ErrExpectedExpr, "1:5", 2, "block comment is not closed"},
+		{"x = 1 /* a\n */ + 2", ErrExpectedExpr, "2:5", 1, ""},
+		{"a, b += 1", ErrInvalidAssignTarget, "1:6", 2, ""},
+		{"x -= 1, 2", ErrInvalidAssignTarget, "1:3", 2, ""},
+		{"[x] *= 2", ErrInvalidAssignTarget, "1:5", 2, ""},
+		{"[1, x] = y", ErrInvalidAssignTarget, "1:2", 1, "only variables, index expressions and array or hash patterns can be assigned"},
+		{"{\"a\": x + 1} = h", ErrInvalidAssignTarget, "1:9", 1, "only variables, index expressions and array or hash patterns can be assigned"},
+		{"a[0].b = 1", ErrInvalidAssignTarget, "1:5", 1, "only variables, index expressions and array or hash patterns can be assigned"},
+	}
+
+	for i, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Fatalf("tests[%d] expected diagnostics, got none", i)
+		}
+
+		err := diagnostics[0]
+		if err.Code != tt.code {
+			t.Errorf("tests[%d] err.Code should be %s, got %s (%s)", i, tt.code, err.Code, err.Message)
+		}
+		if err.Pos.String() != tt.pos {
+			t.Errorf("tests[%d] err.Pos should be %s, got %s", i, tt.pos, err.Pos)
+		}
+		if err.Length != tt.length {
+			t.Errorf("tests[%d] err.Length should be %d, got %d", i, tt.length, err.Length)
+		}
+		if err.Hint != tt.hint {
+			t.Errorf("tests[%d] err.Hint should be %q, got %q", i, tt.hint, err.Hint)
+		}
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 
@@ -0,0 +1,73 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"mlang/parser"
+	"strconv"
+	"strings"
+)
+
+// printParserErrors выводит ошибки разбора вместе со строкой исходного текста,
+// подчеркивая место ошибки:
+//
+//	error[E001]: expected ), got EOF instead
+//	 --> program.mlang:1:6
+//	  |
+//	1 | fn (}
+//	  |      ^
+//	  = hint: ...
+func printParserErrors(out io.Writer, source string, errors []*parser.Error) {
+	lines := strings.Split(source, "\n")
+	for _, err := range errors {
+		io.WriteString(out, renderDiagnostic(lines, err))
+	}
+}
+
+func renderDiagnostic(lines []string, err *parser.Error) string {
+	var out strings.Builder
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(err.Pos.Row)))
+	fmt.Fprintf(&out, "error[%s]: %s\n", err.Code, err.Message)
+	fmt.Fprintf(&out, "%s--> %s\n", gutter, err.Pos)
+
+	if err.Pos.Row >= 1 && err.Pos.Row <= len(lines) {
+		line := strings.TrimRight(lines[err.Pos.Row-1], "\r")
+		fmt.Fprintf(&out, "%s |\n", gutter)
+		fmt.Fprintf(&out, "%d | %s\n", err.Pos.Row, line)
+		fmt.Fprintf(&out, "%s | %s%s\n", gutter, caretPadding(line, err.Pos.Col), underline(err.Length))
+	}
+
+	if err.Hint != "" {
+		fmt.Fprintf(&out, "%s = hint: %s\n", gutter, err.Hint)
+	}
+
+	return out.String()
+}
+
+// caretPadding повторяет отступ строки до столбца col, сохраняя табуляции,
+// чтобы подчеркивание совпало с исходным текстом
+func caretPadding(line string, col int) string {
+	var pad strings.Builder
+	for i, r := range []rune(line) {
+		if i >= col-1 {
+			break
+		}
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+	for i := len([]rune(line)); i < col-1; i++ {
+		pad.WriteRune(' ')
+	}
+	return pad.String()
+}
+
+func underline(length int) string {
+	if length < 1 {
+		length = 1
+	}
+	return "^" + strings.Repeat("~", length-1)
+}
@@ -0,0 +1,97 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"mlang/ast"
+	"mlang/compiler"
+	"mlang/evaluator"
+	"mlang/object"
+	"mlang/vm"
+)
+
+const (
+	ENGINE_EVAL = "eval" // обход синтаксического дерева
+	ENGINE_VM   = "vm"   // компиляция в байт-код и виртуальная машина
+)
+
+// engine способ выполнения программы. Глобальные переменные сохраняются между вызовами run,
+// чтобы в интерактивном режиме строки видели результаты предыдущих
+type engine interface {
+	// globals окружение, в котором разрешаются имена программы перед run
+	globals() *object.Environment
+	run(program *ast.Program) []object.Object
+	// module выполняет программу модуля в собственном окружении globals с контекстом импортирующей программы
+	module(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error
+}
+
+func newEngine(name string, ctx *object.Context) (engine, error) {
+	switch name {
+	case ENGINE_EVAL:
+		env := object.NewEnvironment()
+		interpreter := evaluator.NewInterpreter(env, evaluator.Limits{})
+		interpreter.Context = ctx
+		return &evalEngine{env: env, interpreter: interpreter}, nil
+	case ENGINE_VM:
+		return &vmEngine{env: object.NewEnvironment(), constants: []object.Object{}, ctx: ctx}, nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q", name)
+	}
+}
+
+type evalEngine struct {
+	env         *object.Environment
+	interpreter *evaluator.Interpreter
+}
+
+func (e *evalEngine) globals() *object.Environment {
+	return e.env
+}
+
+func (e *evalEngine) run(program *ast.Program) []object.Object {
+	return e.interpreter.Run(context.Background(), program)
+}
+
+func (e *evalEngine) module(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error {
+	interpreter := evaluator.NewInterpreter(globals, e.interpreter.Limits)
+	interpreter.Context = env
+	return lastError(interpreter.Run(ctx, program))
+}
+
+type vmEngine struct {
+	env       *object.Environment
+	constants []object.Object
+	ctx       *object.Context
+}
+
+func (e *vmEngine) globals() *object.Environment {
+	return e.env
+}
+
+func (e *vmEngine) run(program *ast.Program) []object.Object {
+	c := compiler.NewWithState(e.constants)
+	if err := c.Compile(program); err != nil {
+		return []object.Object{&object.Error{Message: err.Error()}}
+	}
+
+	bytecode := c.Bytecode()
+	e.constants = bytecode.Constants
+	return vm.New(bytecode, e.env, e.ctx).Run()
+}
+
+func (e *vmEngine) module(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return lastError(vm.New(c.Bytecode(), globals, env).Run())
+}
+
+// lastError возвращает ошибку, на которой остановилось выполнение программы
+func lastError(results []object.Object) *object.Error {
+	if len(results) == 0 {
+		return nil
+	}
+	err, _ := results[len(results)-1].(*object.Error)
+	return err
+}
@@ -2,35 +2,76 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mlang/evaluator"
+	"mlang/ast"
 	"mlang/lexer"
+	"mlang/modules"
 	"mlang/object"
 	"mlang/parser"
+	"mlang/resolver"
 	"os"
+	"strings"
 )
 
 const PROMT = ">> "
 
-func Start(in io.Reader, out io.Writer, interactive bool) {
+// Options способ выполнения, потоки ввода-вывода программы и путь поиска модулей
+type Options struct {
+	Engine string    // ENGINE_EVAL или ENGINE_VM
+	Stdin  io.Reader // ввод встроенных функций при выполнении файла, в интерактивном режиме используется in
+	Stderr io.Writer
+	Path   []string // каталоги, в которых import ищет модули, не найденные рядом с импортирующим файлом
+}
+
+// Start выполняет программу из in или, в интерактивном режиме, строки, вводимые пользователем.
+// Встроенные функции выводят результаты в out
+func Start(in io.Reader, out io.Writer, interactive bool, opts Options) error {
+	stdin, stderr := opts.Stdin, opts.Stderr
+	if interactive {
+		stdin = in
+	} else if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+
+	// модули выполняются тем же способом, что и программа
+	var e engine
+	loader := modules.New(opts.Path, func(ctx context.Context, program *ast.Program, globals *object.Environment, env *object.Context) *object.Error {
+		return e.module(ctx, program, globals, env)
+	})
+	ctx := loader.Context(object.NewContext(stdin, out, stderr), fileName(in))
+
+	e, err := newEngine(opts.Engine, ctx)
+	if err != nil {
+		return err
+	}
+	start(in, out, interactive, e, ctx)
+	return nil
+}
+
+func start(in io.Reader, out io.Writer, interactive bool, e engine, ctx *object.Context) {
 	defer func() {
 		if x := recover(); x != nil {
-			fmt.Printf("Something went wrong: %v", x)
+			fmt.Fprintf(out, "Something went wrong: %v", x)
 			if interactive {
-				Start(in, out, interactive)
+				start(in, out, interactive, e, ctx)
 			}
 		}
 	}()
 	if interactive {
-		startShell(in, out)
+		// строки программы и ввод встроенных функций читаются из одного буфера
+		startShell(ctx.In, out, e)
 	} else {
-		startFile(in, out)
+		startFile(in, out, e)
 	}
 }
 
-func startFile(in io.Reader, out io.Writer) {
+func startFile(in io.Reader, out io.Writer, e engine) {
 	text_bytes, err := ioutil.ReadAll(in)
 	if err != nil {
 		fmt.Println("Can not read input file")
@@ -38,60 +79,75 @@ func startFile(in io.Reader, out io.Writer) {
 	}
 
 	text := string(text_bytes)
-	env := object.NewEnvironment()
-	l := lexer.New(text)
+	l := lexer.NewFile(fileName(in), text)
 	p := parser.New(l)
 
 	program := p.ParseProgram()
-	errors := p.Errors()
+	errors := p.Diagnostics()
+	if len(errors) == 0 {
+		errors = resolver.Resolve(program, e.globals())
+	}
 
 	if len(errors) != 0 {
-		printParserErrors(out, errors)
+		printParserErrors(out, text, errors)
 		return
 	}
 
-	evaluated := evaluator.EvalProgram(program.Statements, env)
+	evaluated := e.run(program)
 	if out != os.Stdout {
 		for _, stmt := range evaluated {
-			io.WriteString(out, stmt.Inspect())
-			io.WriteString(out, "\n")
+			printObject(out, stmt)
+		}
+	} else if len(evaluated) != 0 {
+		if err, ok := evaluated[len(evaluated)-1].(*object.Error); ok {
+			printObject(out, err)
 		}
 	}
 }
 
-func startShell(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-
+func startShell(in *bufio.Reader, out io.Writer, e engine) {
 	for {
 		io.WriteString(out, PROMT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
 			return
 		}
+		line = strings.TrimRight(line, "\r\n")
 
-		line := scanner.Text()
 		l := lexer.New(line)
 		p := parser.New(l)
 
 		program := p.ParseProgram()
-		errors := p.Errors()
+		errors := p.Diagnostics()
+		if len(errors) == 0 {
+			errors = resolver.Resolve(program, e.globals())
+		}
 
 		if len(errors) != 0 {
-			printParserErrors(out, errors)
+			printParserErrors(out, line, errors)
 			continue
 		}
 
-		evaluated := evaluator.EvalProgram(program.Statements, env)
+		evaluated := e.run(program)
 		if evaluated != nil {
-			io.WriteString(out, evaluated[len(evaluated)-1].Inspect())
-			io.WriteString(out, "\n")
+			printObject(out, evaluated[len(evaluated)-1])
 		}
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, msg+"\n")
+// fileName возвращает имя файла, из которого читается программа, для позиций в ошибках
+func fileName(in io.Reader) string {
+	if f, ok := in.(interface{ Name() string }); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// printObject выводит результат выражения, для ошибок - вместе со стеком вызовов
+func printObject(out io.Writer, obj object.Object) {
+	io.WriteString(out, obj.Inspect())
+	io.WriteString(out, "\n")
+	if err, ok := obj.(*object.Error); ok {
+		io.WriteString(out, err.StackTrace())
 	}
 }
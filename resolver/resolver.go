@@ -0,0 +1,243 @@
+package resolver
+
+/*
+	Модуль разрешения имен. Выполняется между разбором программы и ее выполнением:
+	для каждого идентификатора находит переменную, к которой он относится, и записывает в узел
+	ее вид, глубину и номер ячейки, а обращения к необъявленным переменным возвращает как ошибки
+	до начала выполнения.
+
+	Правила областей видимости:
+	- переменная, которой присваивается значение на верхнем уровне программы (в том числе внутри
+	  блоков и циклов), глобальная и видна во всей программе, в том числе до присваивания;
+	- переменная, которой присваивается значение внутри функции, и параметры функции
+	  локальны во всем теле функции и видны во вложенных функциях. Пока локальной переменной
+	  ничего не присвоено, чтение находит внешнюю переменную с тем же именем;
+	- остальные имена ищутся среди встроенных функций.
+
+	Порядок чтений и присваиваний в тексте не проверяется: в цикле чтение выше присваивания
+	видит значение с прошлой итерации. Чтение переменной, которой еще ничего не присвоено,
+	- ошибка выполнения
+
+	Кроме того, отмечаются вызовы в хвостовой позиции функций, которые выполняются без роста стека
+*/
+
+import (
+	"mlang/ast"
+	"mlang/evaluator"
+	"mlang/object"
+	"mlang/parser"
+	"unicode/utf8"
+)
+
+const ErrUndefinedVariable = "E008" // обращение к переменной, которая нигде не объявлена
+
+// scope функция, имена которой разрешаются в данный момент
+type scope struct {
+	locals map[string]int
+	names  []string
+	params int // параметры занимают первые ячейки
+	outer  *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{locals: make(map[string]int), outer: outer}
+}
+
+func (s *scope) define(name string) {
+	if _, ok := s.locals[name]; ok {
+		return
+	}
+	s.locals[name] = len(s.names)
+	s.names = append(s.names, name)
+}
+
+type resolver struct {
+	globals *object.Environment
+	scope   *scope
+	errors  []*parser.Error
+}
+
+// Resolve разрешает имена программы. Глобальные переменные заводятся в окружении globals,
+// которое затем используется при выполнении программы
+func Resolve(program *ast.Program, globals *object.Environment) []*parser.Error {
+	r := &resolver{globals: globals}
+	for _, name := range assignedNames(program) {
+		globals.Define(name)
+	}
+	for _, stmt := range program.Statements {
+		r.resolve(stmt)
+	}
+
+	return r.errors
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		r.resolveIdentifier(node)
+	case *ast.AssignStatement:
+		r.resolve(node.Value)
+		if node.Operator != "" {
+			r.resolve(node.Target)
+		}
+		r.resolveTarget(node.Target)
+	case *ast.ImportStatement:
+		r.resolveIdentifier(node.Name)
+	case *ast.TryExpression:
+		r.resolve(node.Block)
+		if node.Catch != nil {
+			r.resolveIdentifier(node.Param)
+			r.resolve(node.Catch)
+		}
+		if node.Finally != nil {
+			r.resolve(node.Finally)
+		}
+	case *ast.FunctionLiteral:
+		r.resolveFunction(node)
+	default:
+		forEachChild(node, r.resolve)
+	}
+}
+
+func (r *resolver) resolveFunction(fn *ast.FunctionLiteral) {
+	r.scope = newScope(r.scope)
+	defer func() { r.scope = r.scope.outer }()
+
+	// параметры занимают первые ячейки по порядку, даже если их имена повторяются
+	for _, param := range fn.Parameters {
+		r.scope.locals[param.Value] = len(r.scope.names)
+		r.scope.names = append(r.scope.names, param.Value)
+		r.resolveIdentifier(param)
+	}
+	r.scope.params = len(fn.Parameters)
+	for _, name := range assignedNames(fn.Body) {
+		r.scope.define(name)
+	}
+	fn.Locals = r.scope.names
+
+	markTailCalls(fn.Body)
+	r.resolve(fn.Body)
+}
+
+// resolveTarget разрешает цель присваивания: переменные, которым присваивается значение,
+// а также переменную и индексы элемента a[i]
+func (r *resolver) resolveTarget(target ast.Expression) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		r.resolveIdentifier(target)
+	case *ast.ArrayLiteral:
+		for _, element := range target.Elements {
+			r.resolveTarget(element)
+		}
+	case *ast.HashLiteral:
+		for i := range target.Keys {
+			r.resolve(target.Keys[i])
+			r.resolveTarget(target.Values[i])
+		}
+	default:
+		r.resolve(target)
+	}
+}
+
+// resolveIdentifier находит переменную id, видимую из текущей области
+func (r *resolver) resolveIdentifier(id *ast.Identifier) {
+	if r.lookup(id, r.scope, 0) {
+		return
+	}
+
+	err := &parser.Error{
+		Pos:     id.Pos(),
+		Length:  utf8.RuneCountInString(id.Value),
+		Code:    ErrUndefinedVariable,
+		Message: "identifier not found: " + id.Value,
+	}
+	if similar := r.similarName(id.Value); similar != "" {
+		err.Hint = "did you mean `" + similar + "`?"
+	}
+	r.errors = append(r.errors, err)
+}
+
+// lookup ищет переменную id в области from, находящейся на depth функций выше места использования,
+// и в окружающих ее. Для локальной переменной, не являющейся параметром, запоминается
+// внешняя переменная с тем же именем
+func (r *resolver) lookup(id *ast.Identifier, from *scope, depth int) bool {
+	for s := from; s != nil; s = s.outer {
+		if slot, ok := s.locals[id.Value]; ok {
+			id.Scope, id.Depth, id.Slot = ast.LOCAL, depth, slot
+			if slot >= s.params {
+				shadowed := &ast.Identifier{Token: id.Token, Value: id.Value}
+				if r.lookup(shadowed, s.outer, depth+1) {
+					id.Shadowed = shadowed
+				}
+			}
+			return true
+		}
+		depth++
+	}
+
+	if slot, ok := r.globals.Lookup(id.Value); ok {
+		id.Scope, id.Depth, id.Slot = ast.GLOBAL, depth, slot
+		return true
+	}
+
+	if _, ok := evaluator.LookupBuiltin(id.Value); ok {
+		id.Scope = ast.BUILTIN
+		return true
+	}
+	return false
+}
+
+// similarName ищет среди видимых переменных имя, отличающееся от name не больше чем на 2 символа
+func (r *resolver) similarName(name string) string {
+	best, bestDistance := "", 3
+	check := func(candidate string) {
+		if d := distance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	for s := r.scope; s != nil; s = s.outer {
+		for _, local := range s.names {
+			check(local)
+		}
+	}
+	for _, global := range r.globals.Names() {
+		check(global)
+	}
+
+	if utf8.RuneCountInString(name) <= bestDistance {
+		return ""
+	}
+	return best
+}
+
+// distance расстояние Левенштейна между строками
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
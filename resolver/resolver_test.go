@@ -0,0 +1,221 @@
+package resolver
+
+import (
+	"mlang/ast"
+	"mlang/lexer"
+	"mlang/object"
+	"mlang/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser errors: %q", errors)
+	}
+	return program
+}
+
+// identifiers собирает идентификаторы программы в порядке обхода
+func identifiers(node ast.Node) []*ast.Identifier {
+	var ids []*ast.Identifier
+	var walk func(ast.Node)
+	walk = func(node ast.Node) {
+		if id, ok := node.(*ast.Identifier); ok {
+			ids = append(ids, id)
+		}
+		forEachChild(node, walk)
+	}
+	walk(node)
+	return ids
+}
+
+func TestResolve(t *testing.T) {
+	input := `x = 1
+	f = func(a) {
+		b = a + x
+		g = func() { a + b + len }
+	}`
+
+	program := parse(t, input)
+	globals := object.NewEnvironment()
+	if errors := Resolve(program, globals); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+
+	tests := []struct {
+		name  string
+		scope ast.Scope
+		depth int
+		slot  int
+	}{
+		{"x", ast.GLOBAL, 0, 0},
+		{"f", ast.GLOBAL, 0, 1},
+		{"a", ast.LOCAL, 0, 0},
+		{"b", ast.LOCAL, 0, 1},
+		{"a", ast.LOCAL, 0, 0},
+		{"x", ast.GLOBAL, 1, 0},
+		{"g", ast.LOCAL, 0, 2},
+		{"a", ast.LOCAL, 1, 0},
+		{"b", ast.LOCAL, 1, 1},
+		{"len", ast.BUILTIN, 0, 0},
+	}
+
+	ids := identifiers(program)
+	if len(ids) != len(tests) {
+		t.Fatalf("program should have %d identifiers, got %d", len(tests), len(ids))
+	}
+	for i, tt := range tests {
+		id := ids[i]
+		if id.Value != tt.name || id.Scope != tt.scope || id.Depth != tt.depth || id.Slot != tt.slot {
+			t.Errorf("tests[%d] identifier should be %s %d %d:%d, got %s %d %d:%d", i,
+				tt.name, tt.scope, tt.depth, tt.slot, id.Value, id.Scope, id.Depth, id.Slot)
+		}
+	}
+
+	if names := strings.Join(globals.Names(), " "); names != "x f" {
+		t.Errorf("globals should be [x f], got [%s]", names)
+	}
+}
+
+func TestFunctionLocals(t *testing.T) {
+	tests := []struct {
+		input  string
+		locals string
+	}{
+		{"func(a, b) { a }", "a b"},
+		{"func(a) { b = a; if (b) { c = 1 } else { a = 2 } }", "a b c"},
+		{"func() { for (i = 0; i < 1; i = i + 1) { while (true) { j = i } } }", "i j"},
+		{"func() { f = func() { inner = 1 } }", "f"},
+		{"func(a, a) { a }", "a a"},
+		{"func() { try { x = 1 } catch (err) { err } }", "x err"},
+		{`func() { import "lib.mlang" as lib; lib.x }`, "lib"},
+		{"func() { a, [b, {c}] = 1, [2, {}]; d = 0; d += 1 }", "a b c d"},
+		{`func(h) { h["k"] = 1; h["k"][0] += 1 }`, "h"},
+	}
+
+	for i, tt := range tests {
+		program := parse(t, tt.input)
+		if errors := Resolve(program, object.NewEnvironment()); len(errors) != 0 {
+			t.Fatalf("tests[%d] resolver errors: %v", i, errors)
+		}
+
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if locals := strings.Join(fn.Locals, " "); locals != tt.locals {
+			t.Errorf("tests[%d] locals should be [%s], got [%s]", i, tt.locals, locals)
+		}
+	}
+}
+
+func TestUndefinedVariables(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors []string
+		hint   string
+	}{
+		{"b = 1 + a", []string{"ERROR: 1:9: identifier not found: a"}, ""},
+		{"x = 1\ny = x + z", []string{"ERROR: 2:9: identifier not found: z"}, ""},
+		{"count = 1; coutn + 1", []string{"ERROR: 1:12: identifier not found: coutn"}, "did you mean `count`?"},
+		{"f = func(value) { valeu }", []string{"ERROR: 1:19: identifier not found: valeu"}, "did you mean `value`?"},
+		{"f = func() { inner = 1 }; inner", []string{"ERROR: 1:27: identifier not found: inner"}, ""},
+		{"arr[0] = 1", []string{"ERROR: 1:1: identifier not found: arr"}, ""},
+		{"a; b", []string{"ERROR: 1:1: identifier not found: a", "ERROR: 1:4: identifier not found: b"}, ""},
+	}
+
+	for i, tt := range tests {
+		errors := Resolve(parse(t, tt.input), object.NewEnvironment())
+		if len(errors) != len(tt.errors) {
+			t.Fatalf("tests[%d] should have %d errors, got %v", i, len(tt.errors), errors)
+		}
+		for j, err := range errors {
+			if err.Error() != tt.errors[j] {
+				t.Errorf("tests[%d] error should be %q, got %q", i, tt.errors[j], err.Error())
+			}
+			if err.Code != ErrUndefinedVariable {
+				t.Errorf("tests[%d] error code should be %s, got %s", i, ErrUndefinedVariable, err.Code)
+			}
+		}
+		if errors[0].Hint != tt.hint {
+			t.Errorf("tests[%d] hint should be %q, got %q", i, tt.hint, errors[0].Hint)
+		}
+	}
+}
+
+func TestReadsAboveAssignment(t *testing.T) {
+	tests := []string{
+		"for (j = 0; j < 3; j = j + 1) { if (j > 0) { print(prev) }; prev = j }",
+		"i = 0; while (i < 3) { if (i > 0) { print(last) }; last = i; i += 1 }",
+		"f = func() { for (j = 0; j < 3; j = j + 1) { if (j > 0) { print(prev) }; prev = j } }",
+		"f = func() { while (false) { print(w) }; w = 1 }",
+		"f = func() { g = func() { y }; y = 1; g() }",
+		"y = x\nx = 1",
+	}
+
+	for i, input := range tests {
+		if errors := Resolve(parse(t, input), object.NewEnvironment()); len(errors) != 0 {
+			t.Errorf("tests[%d] resolver errors: %v", i, errors)
+		}
+	}
+}
+
+func TestGlobalsBetweenPrograms(t *testing.T) {
+	globals := object.NewEnvironment()
+	if errors := Resolve(parse(t, "x = 1"), globals); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+
+	program := parse(t, "y = x")
+	if errors := Resolve(program, globals); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+
+	ids := identifiers(program)
+	if ids[0].Slot != 1 || ids[1].Slot != 0 {
+		t.Errorf("y and x should have slots 1 and 0, got %d and %d", ids[0].Slot, ids[1].Slot)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input string
+		tail  []bool // по вызовам в порядке обхода
+	}{
+		{"func() { f(); g() }", []bool{false, true}},
+		{"func() { if (x) { f() } else { g(); h() } }", []bool{true, false, true}},
+		{"func() { while (x) { return f() }; g() }", []bool{true, true}},
+		{"func() { 1 + f() }", []bool{false}},
+		{"func() { y = f() }", []bool{false}},
+		{"func() { f(g()) }", []bool{true, false}},
+		{"func() { fork f() }", []bool{false}},
+		{"func() { func() { f() } }", []bool{true}},
+		{"func() { try { return f() } catch (e) { g() } finally { h() } }", []bool{false, false, false}},
+		{"func() { try { func() { f() } } finally { 1 } }", []bool{true}},
+		{"f()", []bool{false}},
+	}
+
+	for i, tt := range tests {
+		program := parse(t, "x = 1; f = 1; g = 1; h = 1; "+tt.input)
+		Resolve(program, object.NewEnvironment())
+
+		var calls []*ast.CallExpression
+		var walk func(ast.Node)
+		walk = func(node ast.Node) {
+			if call, ok := node.(*ast.CallExpression); ok {
+				calls = append(calls, call)
+			}
+			forEachChild(node, walk)
+		}
+		walk(program)
+
+		if len(calls) != len(tt.tail) {
+			t.Fatalf("tests[%d] should have %d calls, got %d", i, len(tt.tail), len(calls))
+		}
+		for j, call := range calls {
+			if call.Tail != tt.tail[j] {
+				t.Errorf("tests[%d] call %s tail should be %t", i, call.String(), tt.tail[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package resolver
+
+import "mlang/ast"
+
+// markTailCalls отмечает вызовы в хвостовой позиции тела функции: значение последней инструкции,
+// значение любого return и ветки условия, которое само находится в хвостовой позиции.
+// Вызовы внутри try не хвостовые: после них еще нужно поймать ошибку или выполнить finally
+func markTailCalls(body *ast.BlockStatement) {
+	markTail(body)
+
+	var walk func(ast.Node)
+	walk = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral, *ast.TryExpression:
+			return
+		case *ast.ReturnStatement:
+			markTail(node.ReturnValue)
+		}
+		forEachChild(node, walk)
+	}
+	walk(body)
+}
+
+func markTail(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		node.Tail = true
+	case *ast.IfExpression:
+		markTail(node.Consequence)
+		if node.Alternative != nil {
+			markTail(node.Alternative)
+		}
+	case *ast.BlockStatement:
+		if n := len(node.Statements); n > 0 {
+			markTail(node.Statements[n-1])
+		}
+	case *ast.ExpressionStatement:
+		markTail(node.Expression)
+	case *ast.ReturnStatement:
+		markTail(node.ReturnValue)
+	}
+}
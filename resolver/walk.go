@@ -0,0 +1,137 @@
+package resolver
+
+import "mlang/ast"
+
+// forEachChild вызывает fn для каждого непосредственного потомка узла
+func forEachChild(node ast.Node, fn func(ast.Node)) {
+	visit := func(children ...ast.Node) {
+		for _, child := range children {
+			if child != nil {
+				fn(child)
+			}
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			visit(stmt)
+		}
+	case *ast.AssignStatement:
+		visit(node.Target, node.Value)
+	case *ast.ReturnStatement:
+		visit(node.ReturnValue)
+	case *ast.ThrowStatement:
+		visit(node.Value)
+	case *ast.ImportStatement:
+		visit(node.Name)
+	case *ast.ExpressionStatement:
+		visit(node.Expression)
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			visit(stmt)
+		}
+	case *ast.WhileStatement:
+		visit(node.Condition, node.Body)
+	case *ast.ForStatement:
+		visit(node.Init, node.Condition, node.Step, node.Body)
+	case *ast.IfExpression:
+		visit(node.Condition, node.Consequence)
+		if node.Alternative != nil {
+			visit(node.Alternative)
+		}
+	case *ast.TryExpression:
+		visit(node.Block)
+		if node.Catch != nil {
+			visit(node.Param, node.Catch)
+		}
+		if node.Finally != nil {
+			visit(node.Finally)
+		}
+	case *ast.PrefixExpression:
+		visit(node.Right)
+	case *ast.InfixExpression:
+		visit(node.Left, node.Right)
+	case *ast.FunctionLiteral:
+		for _, param := range node.Parameters {
+			visit(param)
+		}
+		visit(node.Body)
+	case *ast.CallExpression:
+		visit(node.Function)
+		for _, arg := range node.Arguments {
+			visit(arg)
+		}
+	case *ast.ForkExpression:
+		visit(node.Call)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			visit(el)
+		}
+	case *ast.IndexExpression:
+		visit(node.Left, node.Index)
+	case *ast.SelectorExpression:
+		visit(node.Left)
+	case *ast.HashLiteral:
+		for i := range node.Keys {
+			visit(node.Keys[i], node.Values[i])
+		}
+	}
+}
+
+// assignedNames возвращает имена, которым присваивается значение внутри узла (в том числе
+// переменные catch и модули import), не заходя во вложенные функции, в порядке первого присваивания
+func assignedNames(node ast.Node) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	var walk func(ast.Node)
+	walk = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			return
+		case *ast.AssignStatement:
+			targetNames(node.Target, add)
+		case *ast.ImportStatement:
+			add(node.Name.Value)
+		case *ast.TryExpression:
+			// переменная catch получает значение после выполнения блока try
+			walk(node.Block)
+			if node.Catch != nil {
+				add(node.Param.Value)
+				walk(node.Catch)
+			}
+			if node.Finally != nil {
+				walk(node.Finally)
+			}
+			return
+		}
+		forEachChild(node, walk)
+	}
+	walk(node)
+
+	return names
+}
+
+// targetNames передает в add переменные, которые объявляет цель присваивания.
+// Присваивание элементу a[i] изменяет существующую переменную a и не объявляет ее
+func targetNames(target ast.Expression, add func(string)) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		add(target.Value)
+	case *ast.ArrayLiteral:
+		for _, element := range target.Elements {
+			targetNames(element, add)
+		}
+	case *ast.HashLiteral:
+		for _, value := range target.Values {
+			targetNames(value, add)
+		}
+	}
+}
@@ -1,3 +1,9 @@
 go test ./lexer/
 go test ./parser/
 go test ./evaluator/
+go test ./compiler/
+go test ./vm/
+go test ./resolver/
+go test ./mlang/
+go test ./modules/
+go test -race -run 'TestFork' ./evaluator/
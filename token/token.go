@@ -1,27 +1,73 @@
 package token
 
+import (
+	"fmt"
+	"strings"
+)
+
 type TokenType string
 
+// TokenPosition положение токена в исходном тексте.
+// Row и Col начинаются с 1, Col считается в символах, Offset - смещение в байтах
 type TokenPosition struct {
-	Row int
-	Col int
+	File   string
+	Row    int
+	Col    int
+	Offset int
+}
+
+func (p TokenPosition) IsValid() bool {
+	return p.Row > 0
+}
+
+func (p TokenPosition) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Row, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Row, p.Col)
 }
 
 type Token struct {
 	Type    TokenType
 	Literal string
 	Pos     TokenPosition
+
+	// Comments комментарии между предыдущим токеном и этим в порядке их следования в тексте.
+	// Комментарии в конце файла принадлежат токену EOF
+	Comments []Comment
+}
+
+// Comment комментарий в исходном тексте. Text содержит комментарий целиком вместе с // или /* */,
+// но без перевода строки после строчного комментария
+type Comment struct {
+	Text string
+	Pos  TokenPosition
+}
+
+// IsBlock сообщает, что комментарий блочный: /* ... */
+func (c Comment) IsBlock() bool {
+	return strings.HasPrefix(c.Text, "/*")
 }
 
 var keywords = map[string]TokenType{
-	"func":   FUNCTION,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
-	"fork":   FORK,
-	"true":   TRUE,
-	"false":  FALSE,
-	"null":   NULL,
+	"func":     FUNCTION,
+	"return":   RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"fork":     FORK,
+	"true":     TRUE,
+	"false":    FALSE,
+	"null":     NULL,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+	"import":   IMPORT,
+	"as":       AS,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -36,32 +82,53 @@ const (
 	EOF     = "EOF"
 
 	// Ids + literals
-	IDENT = "IDENT"
-	INT   = "INT"
+	IDENT  = "IDENT"
+	INT    = "INT"
+	FLOAT  = "FLOAT"
+	STRING = "STRING"
 
 	// Operators
 	ASSIGN           = "="
+	PLUS_ASSIGN      = "+="
+	MINUS_ASSIGN     = "-="
+	MUL_ASSIGN       = "*="
+	DIV_ASSIGN       = "/="
+	MOD_ASSIGN       = "%="
 	PLUS             = "+"
 	MINUS            = "-"
 	MUL              = "*"
 	DIV              = "/"
+	MOD              = "%"
+	POWER            = "**"
+	INT_DIV          = "~/"
 	LT               = "<"
 	GT               = ">"
+	LT_EQUAL         = "<="
+	GT_EQUAL         = ">="
 	BANG             = "!"
 	EQUAL            = "=="
 	NOT_EQUAL        = "!="
 	DOUBLE_AMPERSAND = "&&"
 	DOUBLE_PIPE      = "||"
+	AMPERSAND        = "&"
+	PIPE             = "|"
 	CARET            = "^"
+	TILDE            = "~"
+	SHIFT_LEFT       = "<<"
+	SHIFT_RIGHT      = ">>"
 
 	// Delimeters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	DOT       = "."
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
+	LPAREN   = "("
+	RPAREN   = ")"
+	LBRACE   = "{"
+	RBRACE   = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
@@ -69,7 +136,17 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	NULL     = "NULL"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	IMPORT   = "IMPORT"
+	AS       = "AS"
 )
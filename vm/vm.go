@@ -0,0 +1,748 @@
+package vm
+
+/*
+	Стековая виртуальная машина, выполняющая байт-код, полученный из пакета compiler.
+	Значения хранятся на собственном стеке, а вызовы функций - в собственных кадрах,
+	поэтому глубина рекурсии не ограничена стеком Go. Операции над значениями и встроенные функции
+	общие с вычислителем (пакет evaluator), поэтому результаты и ошибки совпадают
+*/
+
+import (
+	"context"
+	"fmt"
+	"mlang/compiler"
+	"mlang/evaluator"
+	"mlang/object"
+	"mlang/token"
+)
+
+const (
+	STACK_SIZE = 2048 // начальный размер стека, при необходимости он растет
+	MAX_FRAMES = 1 << 18
+)
+
+// frame кадр вызова функции
+type frame struct {
+	cl       *object.Closure
+	locals   *object.Environment
+	ip       int // смещение следующей инструкции
+	base     int // вершина стека до вызова, без функции и аргументов
+	args     int // число аргументов вызова, создавшего кадр, для стека вызовов
+	handlers []handler
+}
+
+// handler обработчик ошибок, установленный OpTry
+type handler struct {
+	ip int // смещение кода обработчика
+	sp int // вершина стека при установке обработчика
+}
+
+// pos возвращает позицию инструкции, которая выполняется в кадре
+func (f *frame) pos() token.TokenPosition {
+	return f.cl.Fn.Pos(f.ip - 1)
+}
+
+type VM struct {
+	globals *object.Environment
+	main    *object.CompiledFunction
+	ctx     *object.Context // окружение встроенных функций, вызывающих функции в этой машине
+
+	stack  []object.Object
+	sp     int // stack[sp-1] - вершина стека
+	frames []*frame
+
+	results []object.Object
+}
+
+// New создает машину для программы, имена которой разрешены в окружении globals (пакет resolver).
+// В интерактивном режиме одно окружение используется для всех строк.
+// Встроенные функции используют потоки ввода-вывода ctx
+func New(bytecode *compiler.Bytecode, globals *object.Environment, ctx *object.Context) *VM {
+	vm := &VM{
+		globals: globals,
+		main:    bytecode.Main,
+		stack:   make([]object.Object, STACK_SIZE),
+	}
+	vm.ctx = ctx.WithCall(vm.callFunction)
+	return vm
+}
+
+// Run выполняет программу и возвращает результаты инструкций верхнего уровня.
+// Как и у вычислителя, выполнение останавливается на первой ошибке, она становится последним результатом
+func (vm *VM) Run() []object.Object {
+	vm.results = nil
+	vm.pushFrame(&object.Closure{Fn: vm.main, Globals: vm.globals}, vm.globals)
+	if _, err := vm.run(0); err != nil {
+		vm.results = append(vm.results, err)
+	}
+	return vm.results
+}
+
+// fork создает машину для задачи: глобальные переменные общие, а стек и кадры свои
+func (vm *VM) fork() *VM {
+	child := &VM{
+		globals: vm.globals,
+		main:    vm.main,
+		stack:   make([]object.Object, STACK_SIZE),
+	}
+	child.ctx = vm.ctx.WithCall(child.callFunction)
+	return child
+}
+
+// run выполняет инструкции, пока не завершится функция в кадре с номером base.
+// Ошибку перехватывает последний обработчик в кадрах начиная с base, а если его нет,
+// эти кадры снимаются, а ошибка получает позицию и стек вызовов
+func (vm *VM) run(base int) (object.Object, *object.Error) {
+	for {
+		result, err := vm.exec(base)
+		if err == nil || !vm.unwind(err, base) {
+			return result, err
+		}
+	}
+}
+
+// exec выполняет инструкции до завершения функции в кадре base или до первой ошибки
+func (vm *VM) exec(base int) (object.Object, *object.Error) {
+	for {
+		f := vm.frames[len(vm.frames)-1]
+		ins := f.cl.Fn.Instructions
+		op := compiler.Opcode(ins[f.ip])
+		f.ip++
+
+		switch op {
+		case compiler.OpConstant:
+			idx := compiler.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			vm.push(f.cl.Fn.Constants[idx])
+
+		case compiler.OpNull:
+			vm.push(evaluator.NULL)
+		case compiler.OpTrue:
+			vm.push(evaluator.TRUE)
+		case compiler.OpFalse:
+			vm.push(evaluator.FALSE)
+
+		case compiler.OpPop:
+			vm.sp--
+		case compiler.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+		case compiler.OpResult:
+			vm.results = append(vm.results, vm.pop())
+		case compiler.OpHalt:
+			vm.frames = vm.frames[:base]
+			return nil, nil
+
+		case compiler.OpAdd, compiler.OpSub, compiler.OpMul, compiler.OpDiv,
+			compiler.OpIntDiv, compiler.OpMod, compiler.OpPow,
+			compiler.OpEqual, compiler.OpNotEqual, compiler.OpLess, compiler.OpGreater,
+			compiler.OpLessEqual, compiler.OpGreaterEqual, compiler.OpXor, compiler.OpBitXor,
+			compiler.OpBitAnd, compiler.OpBitOr, compiler.OpShiftLeft, compiler.OpShiftRight:
+			right := vm.pop()
+			left := vm.pop()
+			result := binaryOperation(op, left, right)
+			if err, ok := result.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(result)
+
+		case compiler.OpMinus, compiler.OpBang, compiler.OpBitNot:
+			result := evaluator.EvalPrefix(operators[op], vm.pop())
+			if err, ok := result.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(result)
+
+		case compiler.OpJump:
+			f.ip = int(compiler.ReadUint32(ins[f.ip:]))
+		case compiler.OpJumpNotTruthy:
+			target := int(compiler.ReadUint32(ins[f.ip:]))
+			f.ip += 4
+			if !evaluator.IsTruthy(vm.pop()) {
+				f.ip = target
+			}
+		case compiler.OpJumpTruthy:
+			target := int(compiler.ReadUint32(ins[f.ip:]))
+			f.ip += 4
+			if evaluator.IsTruthy(vm.pop()) {
+				f.ip = target
+			}
+
+		case compiler.OpGetGlobal:
+			idx := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			value := f.cl.Globals.Get(0, idx)
+			if value == nil {
+				// глобальной переменной еще ничего не присвоено, но может быть встроенная функция с тем же именем
+				name := f.cl.Globals.Name(0, idx)
+				builtin, ok := evaluator.LookupBuiltin(name)
+				if !ok {
+					return nil, object.NewError(object.NAME_ERROR, "identifier not found: %s", name)
+				}
+				value = builtin
+			}
+			vm.push(value)
+		case compiler.OpSetGlobal:
+			idx := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			f.cl.Globals.Set(0, idx, vm.stack[vm.sp-1])
+		case compiler.OpGetBuiltin:
+			idx := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			name := f.cl.Fn.Constants[idx].(*object.String).Value
+			builtin, ok := evaluator.LookupBuiltin(name)
+			if !ok {
+				return nil, object.NewError(object.NAME_ERROR, "identifier not found: %s", name)
+			}
+			vm.push(builtin)
+
+		case compiler.OpGetLocal:
+			slot := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			value := f.locals.Get(0, slot)
+			if value == nil {
+				return nil, object.NewError(object.NAME_ERROR, "identifier not found: %s", f.locals.Name(0, slot))
+			}
+			vm.push(value)
+		case compiler.OpSetLocal:
+			slot := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			f.locals.Set(0, slot, vm.stack[vm.sp-1])
+		case compiler.OpGetFree:
+			depth := int(ins[f.ip])
+			slot := int(compiler.ReadUint16(ins[f.ip+1:]))
+			f.ip += 3
+			value := f.locals.Get(depth, slot)
+			if value == nil {
+				return nil, object.NewError(object.NAME_ERROR, "identifier not found: %s", f.locals.Name(depth, slot))
+			}
+			vm.push(value)
+
+		case compiler.OpGetIfSet:
+			depth := int(ins[f.ip])
+			slot := int(compiler.ReadUint16(ins[f.ip+1:]))
+			target := int(compiler.ReadUint32(ins[f.ip+3:]))
+			f.ip += 7
+			if value := f.locals.Get(depth, slot); value != nil {
+				vm.push(value)
+				f.ip = target
+			}
+		case compiler.OpSetFree:
+			depth := int(ins[f.ip])
+			slot := int(compiler.ReadUint16(ins[f.ip+1:]))
+			f.ip += 3
+			f.locals.Set(depth, slot, vm.stack[vm.sp-1])
+
+		case compiler.OpArray:
+			n := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			vm.push(&object.Array{Elements: elements})
+		case compiler.OpHash:
+			n := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			hash, err := vm.buildHash(n)
+			if err != nil {
+				return nil, err
+			}
+			vm.push(hash)
+		case compiler.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			result := evaluator.EvalIndex(left, index)
+			if err, ok := result.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(result)
+
+		case compiler.OpSetIndex:
+			n := int(ins[f.ip])
+			f.ip++
+			indices := vm.popValues(n)
+			container := vm.pop()
+			updated := evaluator.SetIndex(container, indices, vm.stack[vm.sp-1], false)
+			if err, ok := updated.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(updated)
+		case compiler.OpUpdateIndex:
+			n := int(ins[f.ip])
+			op := compiler.Opcode(ins[f.ip+1])
+			f.ip += 2
+			indices := vm.popValues(n)
+			container := vm.pop()
+			result, updated := evaluator.UpdateIndex(container, indices, operators[op], vm.pop(), false)
+			if err, ok := updated.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(result)
+			vm.push(updated)
+		case compiler.OpPeek:
+			global := ins[f.ip] == 1
+			env, depth, slot := f.variable(ins[f.ip:])
+			f.ip += 4
+			value := env.Peek(depth, slot, vm)
+			if value == nil {
+				var err *object.Error
+				if value, err = unassigned(env, global, depth, slot); err != nil {
+					return nil, err
+				}
+			}
+			vm.push(value)
+		case compiler.OpSetElement:
+			n := int(ins[f.ip])
+			global := ins[f.ip+1] == 1
+			env, depth, slot := f.variable(ins[f.ip+1:])
+			f.ip += 5
+			indices := vm.popValues(n)
+			value := vm.stack[vm.sp-1]
+			if err := vm.updateElement(env, global, depth, slot, func(container object.Object, inPlace bool) object.Object {
+				return evaluator.SetIndex(container, indices, value, inPlace)
+			}); err != nil {
+				return nil, err
+			}
+		case compiler.OpUpdateElement:
+			n := int(ins[f.ip])
+			op := compiler.Opcode(ins[f.ip+1])
+			global := ins[f.ip+2] == 1
+			env, depth, slot := f.variable(ins[f.ip+2:])
+			f.ip += 6
+			indices := vm.popValues(n)
+			value := vm.pop()
+			var result object.Object
+			if err := vm.updateElement(env, global, depth, slot, func(container object.Object, inPlace bool) object.Object {
+				var updated object.Object
+				result, updated = evaluator.UpdateIndex(container, indices, operators[op], value, inPlace)
+				return updated
+			}); err != nil {
+				return nil, err
+			}
+			vm.push(result)
+		case compiler.OpUnpack:
+			n := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			elements, err := evaluator.UnpackArray(vm.pop(), n)
+			if err != nil {
+				return nil, err
+			}
+			for i := n - 1; i >= 0; i-- {
+				vm.push(elements[i])
+			}
+		case compiler.OpUnpackHash:
+			n := int(compiler.ReadUint16(ins[f.ip:]))
+			f.ip += 2
+			keys := vm.popValues(n)
+			values, err := evaluator.UnpackHash(vm.pop(), keys)
+			if err != nil {
+				return nil, err
+			}
+			for i := n - 1; i >= 0; i-- {
+				vm.push(values[i])
+			}
+
+		case compiler.OpSelect:
+			idx := compiler.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			name := f.cl.Fn.Constants[idx].(*object.String).Value
+			result := evaluator.EvalSelector(vm.pop(), name)
+			if err, ok := result.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(result)
+
+		case compiler.OpClosure:
+			idx := compiler.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			fn := f.cl.Fn.Constants[idx].(*object.CompiledFunction)
+			vm.push(&object.Closure{Fn: fn, Env: f.locals, Globals: f.cl.Globals})
+
+		case compiler.OpCall:
+			argc := int(ins[f.ip])
+			f.ip += 3
+			if err := vm.call(argc); err != nil {
+				return nil, err
+			}
+
+		case compiler.OpTailCall:
+			argc := int(ins[f.ip])
+			f.ip += 3
+			if vm.tailCall(f, argc) {
+				continue
+			}
+			if err := vm.call(argc); err != nil {
+				return nil, err
+			}
+
+		case compiler.OpReturnValue:
+			value := vm.pop()
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.sp = f.base
+			if len(vm.frames) == base {
+				return value, nil
+			}
+			vm.push(value)
+
+		case compiler.OpLoopControl:
+			err := newError("%s outside loop", loopControl(int(ins[f.ip])).Inspect())
+			f.ip++
+			if f.cl.Fn != vm.main {
+				// как и в вычислителе, ошибка относится к вызову функции, из которой вышли break или continue
+				vm.frames = vm.frames[:len(vm.frames)-1]
+				vm.sp = f.base
+				if len(vm.frames) == base {
+					return nil, err
+				}
+			}
+			return nil, err
+
+		case compiler.OpFork:
+			argc := int(ins[f.ip])
+			f.ip++
+			task, err := vm.forkCall(argc)
+			if err != nil {
+				return nil, err
+			}
+			vm.push(task)
+
+		case compiler.OpTry:
+			target := int(compiler.ReadUint32(ins[f.ip:]))
+			f.ip += 4
+			f.handlers = append(f.handlers, handler{ip: target, sp: vm.sp})
+		case compiler.OpPopHandler:
+			f.handlers = f.handlers[:len(f.handlers)-1]
+		case compiler.OpCatch:
+			vm.stack[vm.sp-1] = evaluator.CaughtError(vm.stack[vm.sp-1].(*object.Error))
+		case compiler.OpImport:
+			idx := compiler.ReadUint16(ins[f.ip:])
+			f.ip += 2
+			path := f.cl.Fn.Constants[idx].(*object.String).Value
+			module := evaluator.Import(context.Background(), vm.ctx, path, f.pos().File)
+			if err, ok := module.(*object.Error); ok {
+				return nil, err
+			}
+			vm.push(module)
+
+		case compiler.OpThrow:
+			value := vm.pop()
+			if err, ok := value.(*object.Error); ok {
+				// ошибка, которую обработчик finally бросает дальше
+				return nil, err
+			}
+			return nil, evaluator.ThrownError(value)
+
+		default:
+			return nil, newError("unknown opcode %d", op)
+		}
+	}
+}
+
+// call вызывает функцию, лежащую на стеке под argc аргументами.
+// Для скомпилированной функции создается новый кадр, встроенная функция выполняется сразу
+func (vm *VM) call(argc int) *object.Error {
+	callee := vm.stack[vm.sp-1-argc]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if len(callee.Fn.Parameters) != argc {
+			return object.NewError(object.ARGUMENT_ERROR, "function expects %d arguments, %d was given", len(callee.Fn.Parameters), argc)
+		}
+		if len(vm.frames) >= MAX_FRAMES {
+			return object.NewError(object.RECURSION_ERROR, "max recursion level reached")
+		}
+		locals := vm.newLocals(callee, vm.stack[vm.sp-argc:vm.sp])
+		vm.sp -= argc + 1
+		vm.pushFrame(callee, locals)
+		return nil
+	case *object.Builtin:
+		args := make([]object.Object, argc)
+		copy(args, vm.stack[vm.sp-argc:vm.sp])
+		vm.sp -= argc + 1
+		result := callee.Fn(vm.ctx, args...)
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		vm.push(result)
+		return nil
+	default:
+		return object.NewError(object.TYPE_ERROR, "not a function: %s", callee.Type())
+	}
+}
+
+// tailCall выполняет вызов в хвостовой позиции в кадре f, если вызывается скомпилированная функция
+// с подходящим числом аргументов. Иначе вызов выполняется обычным образом
+func (vm *VM) tailCall(f *frame, argc int) bool {
+	callee, ok := vm.stack[vm.sp-1-argc].(*object.Closure)
+	if !ok || len(callee.Fn.Parameters) != argc {
+		return false
+	}
+
+	f.locals = vm.newLocals(callee, vm.stack[vm.sp-argc:vm.sp])
+	f.cl = callee
+	f.ip = 0
+	vm.sp = f.base
+	return true
+}
+
+// callFunction вызывает функцию вне основного цикла: из встроенных функций и в задачах.
+// Возвращает результат или ошибку без позиции вызова
+func (vm *VM) callFunction(fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Closure:
+		if len(fn.Fn.Parameters) != len(args) {
+			return object.NewError(object.ARGUMENT_ERROR, "function expects %d arguments, %d was given", len(fn.Fn.Parameters), len(args))
+		}
+		if len(vm.frames) >= MAX_FRAMES {
+			return object.NewError(object.RECURSION_ERROR, "max recursion level reached")
+		}
+		sp := vm.sp
+		locals := vm.newLocals(fn, args)
+		vm.pushFrame(fn, locals)
+
+		result, err := vm.run(len(vm.frames) - 1)
+		vm.sp = sp
+		if err != nil {
+			return err
+		}
+		return result
+	case *object.Builtin:
+		return fn.Fn(vm.ctx, args...)
+	default:
+		return object.NewError(object.TYPE_ERROR, "not a function: %s", fn.Type())
+	}
+}
+
+// forkCall запускает функцию, лежащую на стеке под argc аргументами, в отдельной горутине
+func (vm *VM) forkCall(argc int) (object.Object, *object.Error) {
+	callee := vm.stack[vm.sp-1-argc]
+	args := make([]object.Object, argc)
+	copy(args, vm.stack[vm.sp-argc:vm.sp])
+	vm.sp -= argc + 1
+
+	switch callee.(type) {
+	case *object.Closure, *object.Builtin:
+	default:
+		return nil, object.NewError(object.TYPE_ERROR, "not a function: %s", callee.Type())
+	}
+
+	task := object.NewTask()
+	child := vm.fork()
+	go func() {
+		var result object.Object
+		defer func() {
+			if x := recover(); x != nil {
+				result = newError("task panicked: %v", x)
+			}
+			task.Resolve(result)
+		}()
+		result = child.callFunction(callee, args)
+	}()
+
+	return task, nil
+}
+
+// unwind дополняет ошибку позицией выполняемой инструкции и ищет для нее обработчик в кадрах
+// начиная с base. Кадры без обработчиков снимаются и попадают в стек вызовов ошибки.
+// Если обработчик найден, выполнение продолжается с него, а ошибка лежит на вершине стека
+func (vm *VM) unwind(err *object.Error, base int) bool {
+	top := len(vm.frames) - 1
+	if !err.Pos.IsValid() && top >= base {
+		err.Pos = vm.frames[top].pos()
+	}
+
+	for i := top; i >= base; i-- {
+		f := vm.frames[i]
+		if n := len(f.handlers); n > 0 && evaluator.Catchable(err) {
+			h := f.handlers[n-1]
+			f.handlers = f.handlers[:n-1]
+			vm.frames = vm.frames[:i+1]
+			vm.sp = h.sp
+			vm.push(err)
+			f.ip = h.ip
+			return true
+		}
+		if i > base {
+			caller := vm.frames[i-1]
+			err.Stack = append(err.Stack, object.StackFrame{
+				Function: vm.callName(caller),
+				Pos:      caller.pos(),
+				Args:     f.args,
+			})
+		}
+	}
+
+	vm.frames = vm.frames[:base]
+	return false
+}
+
+// callName возвращает имя функции, вызванной последней инструкцией OpCall или OpTailCall кадра
+func (vm *VM) callName(f *frame) string {
+	idx := compiler.ReadUint16(f.cl.Fn.Instructions[f.ip-2:])
+	return f.cl.Fn.Constants[idx].(*object.String).Value
+}
+
+// variable возвращает окружение, глубину и номер переменной по операндам признака глобальной, глубины и номера
+func (f *frame) variable(operands []byte) (*object.Environment, int, int) {
+	slot := int(compiler.ReadUint16(operands[2:]))
+	if operands[0] == 1 {
+		return f.cl.Globals, 0, slot
+	}
+	return f.locals, int(operands[1]), slot
+}
+
+// unassigned возвращает значение переменной, которой ничего не присвоено: встроенную функцию
+// с тем же именем для глобальной переменной или ошибку
+func unassigned(env *object.Environment, global bool, depth int, slot int) (object.Object, *object.Error) {
+	name := env.Name(depth, slot)
+	if global {
+		if builtin, ok := evaluator.LookupBuiltin(name); ok {
+			return builtin, nil
+		}
+	}
+	return nil, object.NewError(object.NAME_ERROR, "identifier not found: %s", name)
+}
+
+// updateElement присваивает переменной результат update для ее значения. update вызывается под блокировкой
+// окружения и может изменить значение на месте, если оно принадлежит этой машине
+func (vm *VM) updateElement(env *object.Environment, global bool, depth int, slot int,
+	update func(container object.Object, inPlace bool) object.Object) *object.Error {
+	updated := env.Update(depth, slot, vm, func(container object.Object, owned bool) object.Object {
+		if container == nil {
+			return nil
+		}
+		return update(container, owned)
+	})
+	if updated == nil {
+		container, err := unassigned(env, global, depth, slot)
+		if err != nil {
+			return err
+		}
+		updated = update(container, false)
+	}
+	err, _ := updated.(*object.Error)
+	return err
+}
+
+func (vm *VM) buildHash(n int) (object.Object, *object.Error) {
+	hash := object.NewHash()
+	start := vm.sp - 2*n
+
+	for i := start; i < vm.sp; i += 2 {
+		key, ok := vm.stack[i].(object.Hashable)
+		if !ok {
+			return nil, object.NewError(object.TYPE_ERROR, "unusable as hash key: %s", vm.stack[i].Type())
+		}
+		hash.Set(key, vm.stack[i+1])
+	}
+
+	vm.sp = start
+	return hash, nil
+}
+
+// newLocals создает окружение вызова функции. Параметры занимают первые ячейки
+func (vm *VM) newLocals(cl *object.Closure, args []object.Object) *object.Environment {
+	locals := object.NewEnclosedEnvironment(cl.Env, cl.Fn.Locals)
+	for slot, arg := range args {
+		locals.Set(0, slot, arg)
+	}
+	return locals
+}
+
+func (vm *VM) pushFrame(cl *object.Closure, locals *object.Environment) {
+	vm.frames = append(vm.frames, &frame{cl: cl, locals: locals, base: vm.sp, args: len(cl.Fn.Parameters)})
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp == len(vm.stack) {
+		vm.stack = append(vm.stack, obj)
+	} else {
+		vm.stack[vm.sp] = obj
+	}
+	vm.sp++
+}
+
+// popValues снимает со стека n значений и возвращает их в порядке, в котором они были положены
+func (vm *VM) popValues(n int) []object.Object {
+	values := make([]object.Object, n)
+	copy(values, vm.stack[vm.sp-n:vm.sp])
+	vm.sp -= n
+	return values
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+var operators = map[compiler.Opcode]string{
+	compiler.OpAdd:          "+",
+	compiler.OpSub:          "-",
+	compiler.OpMul:          "*",
+	compiler.OpDiv:          "/",
+	compiler.OpIntDiv:       "~/",
+	compiler.OpMod:          "%",
+	compiler.OpPow:          "**",
+	compiler.OpEqual:        "==",
+	compiler.OpNotEqual:     "!=",
+	compiler.OpLess:         "<",
+	compiler.OpGreater:      ">",
+	compiler.OpLessEqual:    "<=",
+	compiler.OpGreaterEqual: ">=",
+	compiler.OpXor:          "^",
+	compiler.OpBitXor:       "~",
+	compiler.OpBitAnd:       "&",
+	compiler.OpBitOr:        "|",
+	compiler.OpShiftLeft:    "<<",
+	compiler.OpShiftRight:   ">>",
+	compiler.OpMinus:        "-",
+	compiler.OpBang:         "!",
+	compiler.OpBitNot:       "~",
+}
+
+// binaryOperation выполняет бинарный оператор. Самые частые операции над целыми числами
+// выполняются на месте, остальные - так же, как в вычислителе
+func binaryOperation(op compiler.Opcode, left object.Object, right object.Object) object.Object {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			switch op {
+			case compiler.OpAdd:
+				return evaluator.AddIntegers(l.Value, r.Value)
+			case compiler.OpSub:
+				return evaluator.SubIntegers(l.Value, r.Value)
+			case compiler.OpMul:
+				return evaluator.MulIntegers(l.Value, r.Value)
+			case compiler.OpEqual:
+				return nativeBool(l.Value == r.Value)
+			case compiler.OpNotEqual:
+				return nativeBool(l.Value != r.Value)
+			case compiler.OpLess:
+				return nativeBool(l.Value < r.Value)
+			case compiler.OpGreater:
+				return nativeBool(l.Value > r.Value)
+			case compiler.OpLessEqual:
+				return nativeBool(l.Value <= r.Value)
+			case compiler.OpGreaterEqual:
+				return nativeBool(l.Value >= r.Value)
+			}
+		}
+	}
+	return evaluator.EvalInfix(operators[op], left, right)
+}
+
+func nativeBool(value bool) *object.Boolean {
+	if value {
+		return evaluator.TRUE
+	}
+	return evaluator.FALSE
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func loopControl(kind int) object.Object {
+	if kind == compiler.LoopBreak {
+		return evaluator.BREAK
+	}
+	return evaluator.CONTINUE
+}
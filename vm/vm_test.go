@@ -0,0 +1,112 @@
+package vm
+
+import (
+	"io/ioutil"
+	"mlang/compiler"
+	"mlang/lexer"
+	"mlang/object"
+	"mlang/parser"
+	"mlang/resolver"
+	"strings"
+	"testing"
+)
+
+var discard = object.NewContext(strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+
+func run(t *testing.T, input string) []object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 0 {
+		t.Fatalf("parser errors: %q", errors)
+	}
+
+	globals := object.NewEnvironment()
+	if errors := resolver.Resolve(program, globals); len(errors) != 0 {
+		t.Fatalf("resolver errors: %v", errors)
+	}
+
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(c.Bytecode(), globals, discard).Run()
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input string
+		res   string
+	}{
+		{"deep = func(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } }; deep(100000)", "100000"},
+		{"s = 0; i = 0; while (true) { i = i + 1; s = s + if (i > 3) { break } else { i } }; s", "6"},
+		{"s = 0; for (i = 0; i < 5; i = i + 1) { s = s + [if (i == 2) { continue } else { i }][0] }; s", "8"},
+		{"f = func() { g = func(n) { if (n == 0) { 0 } else { g(n - 1) } }; g(3) }; f()", "0"},
+		{"make = func(x) { func(y) { func(z) { x + y + z } } }; make(1)(2)(3)", "6"},
+		{"f = func() { return 1; 2 }; f()", "1"},
+		{"if (true) { return 5 }; 6", "5"},
+		{"x = 0; f = func() { x + 1 }; x = 41; f()", "42"},
+		{"i = 0; f = func() { i }; forn(3, f); i", "2"},
+		{"f = func(a, a) { a }; f(1, 2)", "2"},
+		{"t = fork func(x) { x * 2 }(21); await(t)", "42"},
+	}
+
+	for i, tt := range tests {
+		results := run(t, tt.input)
+		last := results[len(results)-1]
+
+		if last.Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %s, got %s", i, tt.res, last.Inspect())
+		}
+	}
+}
+
+func TestRunWithError(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"f = func() { 1 + f() }; f()", "ERROR: 1:19: max recursion level reached"},
+		{"f = func(c) { if (c) { x = 1 }; x }; f(false)", "ERROR: 1:33: identifier not found: x"},
+		{"f = func() { g = func() { h }; g() }; f(); h = 1", "ERROR: 1:27: identifier not found: h"},
+		{"f = func() { g = func() { y }; g(); y = 1 }; f()", "ERROR: 1:27: identifier not found: y"},
+	}
+
+	for i, tt := range tests {
+		results := run(t, tt.input)
+		last := results[len(results)-1]
+
+		if last.Inspect() != tt.err {
+			t.Fatalf("tests[%d] result should be %q, got %q", i, tt.err, last.Inspect())
+		}
+	}
+}
+
+func TestGlobalsBetweenRuns(t *testing.T) {
+	globals := object.NewEnvironment()
+	constants := []object.Object{}
+
+	for i, tt := range []struct {
+		input string
+		res   string
+	}{
+		{"x = 5", "5"},
+		{"f = func(y) { x * y }", "<function (y )>"},
+		{"f(2)", "10"},
+	} {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if errors := resolver.Resolve(program, globals); len(errors) != 0 {
+			t.Fatalf("tests[%d] resolver errors: %v", i, errors)
+		}
+		c := compiler.NewWithState(constants)
+		if err := c.Compile(program); err != nil {
+			t.Fatalf("tests[%d] compiler error: %s", i, err)
+		}
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+
+		results := New(bytecode, globals, discard).Run()
+		if results[0].Inspect() != tt.res {
+			t.Fatalf("tests[%d] result should be %s, got %s", i, tt.res, results[0].Inspect())
+		}
+	}
+}